@@ -0,0 +1,184 @@
+// Persistbench compares the throughput of inserting chat messages one by one, as the room hubs did before,
+// with the batched inserts of the message persister. It creates temporary rooms owned by an existing user
+// in the database of config/config.yml and deletes them afterwards, with their messages.
+// It is a manual tool run against a real database, not a part of go test; the persister itself
+// is covered by the tests of the service package.
+//
+//	go run ./cmd/persistbench -user 1 -messages 20000 -rooms 50
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"chat-server/config"
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+	"chat-server/internal/repository"
+	"chat-server/internal/service"
+	"chat-server/pkg/db"
+)
+
+type options struct {
+	userID        entity.ID
+	messages      int
+	rooms         int
+	batchSize     int
+	flushInterval time.Duration
+	queueSize     int
+}
+
+func main() {
+	userID := flag.Uint("user", 1, "ID of an existing user sending the messages")
+	messages := flag.Int("messages", 10000, "number of messages inserted by each path")
+	rooms := flag.Int("rooms", 10, "number of rooms, each sending its messages in order like a hub")
+	batchSize := flag.Int("batch", 100, "batch size of the persister")
+	flushInterval := flag.Duration("interval", 5*time.Millisecond, "flush interval of the persister")
+	queueSize := flag.Int("queue", 1024, "queue size of the persister")
+	flag.Parse()
+
+	cfg := config.Config{}
+	if err := cfg.Parse(); err != nil {
+		log.Fatalf("error parsing config: %v", err)
+	}
+	db.StartDbConnection(cfg.GetDBConfig())
+
+	err := benchmark(&options{
+		userID:        entity.ID(*userID),
+		messages:      *messages,
+		rooms:         *rooms,
+		batchSize:     *batchSize,
+		flushInterval: *flushInterval,
+		queueSize:     *queueSize,
+	})
+	db.CloseDbConnection()
+	if err != nil {
+		log.Fatalf("error running benchmark: %v", err)
+	}
+}
+
+// benchmark runs both paths in temporary rooms, which are deleted whatever the outcome.
+func benchmark(opts *options) error {
+	if opts.rooms <= 0 || opts.messages < opts.rooms {
+		return errors.New("benchmark: rooms must be positive and at most messages")
+	}
+	conn := db.GetDBConn()
+
+	roomRep := repository.NewRoomRepository(conn)
+	messageSvc := service.NewMessageService(
+		repository.NewMessageRepository(conn),
+		repository.NewReadCursorRepository(conn),
+		repository.NewDeliveryCursorRepository(conn),
+		repository.NewReactionRepository(conn),
+		repository.NewPinRepository(conn),
+	)
+
+	roomIDs := make([]entity.ID, 0, opts.rooms)
+	defer func() {
+		for _, roomID := range roomIDs {
+			if err := roomRep.DeleteRoom(roomID); err != nil {
+				log.Printf("error deleting room %d: %v", roomID, err)
+			}
+		}
+	}()
+	for i := 0; i < opts.rooms; i++ {
+		room, err := roomRep.InsertRoom(&entity.Room{
+			OwnerID: opts.userID,
+			Name:    fmt.Sprintf("persistbench %d", i),
+		})
+		if err != nil {
+			return fmt.Errorf("benchmark: %w", err)
+		}
+		roomIDs = append(roomIDs, room.ID)
+	}
+
+	perRoom := opts.messages / opts.rooms
+	total := perRoom * opts.rooms
+
+	elapsed := run(opts.userID, roomIDs, perRoom, func(req *entity.CreateMessageReq, done func()) {
+		if _, _, err := messageSvc.CreateMessage(req); err != nil {
+			log.Printf("error creating message: %v", err)
+		}
+		done()
+	})
+	report("per-message insert", total, elapsed)
+
+	persister := service.NewMessagePersister(&service.PersisterConfig{
+		BatchSize:     opts.batchSize,
+		FlushInterval: opts.flushInterval,
+		QueueSize:     opts.queueSize,
+	}, messageSvc)
+	persister.Start()
+
+	elapsed = run(opts.userID, roomIDs, perRoom, func(req *entity.CreateMessageReq, done func()) {
+		persister.Persist(req, func(_ *entity.Message, _ bool, err error) {
+			if err != nil {
+				log.Printf("error creating message: %v", err)
+			}
+			done()
+		})
+	})
+	persister.Stop()
+	report(fmt.Sprintf("batched insert (batch %d)", opts.batchSize), total, elapsed)
+
+	if err := verifyOrder(messageSvc, roomIDs, perRoom); err != nil {
+		return fmt.Errorf("benchmark: %w", err)
+	}
+	return nil
+}
+
+// run sends the messages of every room from its own goroutine, as the hub of the room does,
+// and returns the time until all of them are persisted.
+func run(
+	senderID entity.ID,
+	roomIDs []entity.ID,
+	perRoom int,
+	persist func(req *entity.CreateMessageReq, done func()),
+) time.Duration {
+	var wg sync.WaitGroup
+	wg.Add(len(roomIDs) * perRoom)
+
+	start := time.Now()
+	for _, roomID := range roomIDs {
+		go func(roomID entity.ID) {
+			for i := 0; i < perRoom; i++ {
+				persist(&entity.CreateMessageReq{
+					SenderID: senderID,
+					RoomID:   roomID,
+					Content:  entity.NonEmptyString(fmt.Sprintf("message %d", i)),
+				}, wg.Done)
+			}
+		}(roomID)
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+func report(name string, total int, elapsed time.Duration) {
+	fmt.Printf("%-32s %8d messages %10s %10.0f messages/s\n",
+		name, total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
+}
+
+// verifyOrder checks that the IDs of the messages of every room follow the order they were sent in.
+func verifyOrder(messageUseCase use_case.MessageUseCase, roomIDs []entity.ID, perRoom int) error {
+	for _, roomID := range roomIDs {
+		messages, err := messageUseCase.GetMessageBulkAfterID(roomID, 0, uint(2*perRoom))
+		if err != nil {
+			return fmt.Errorf("verifyOrder: %w", err)
+		}
+		// each path sends the messages 0, 1, ... to the room, so in ID order the contents repeat once
+		for i, message := range messages {
+			expected := entity.NonEmptyString(fmt.Sprintf("message %d", i%perRoom))
+			if message.Content != expected {
+				return fmt.Errorf("verifyOrder: room %d: message %d is out of order: %q",
+					roomID, message.ID, message.Content)
+			}
+		}
+	}
+	fmt.Println("message order preserved in every room")
+	return nil
+}
@@ -10,7 +10,9 @@ import (
 	"time"
 
 	"github.com/spf13/viper"
+	"nhooyr.io/websocket"
 
+	"chat-server/internal/domain/entity"
 	"chat-server/internal/service"
 	"chat-server/pkg/db"
 	"chat-server/pkg/redis"
@@ -25,6 +27,11 @@ type Config struct {
 		ReadTimeout    time.Duration `mapstructure:"read_timeout"`
 		WriteTimeout   time.Duration `mapstructure:"write_timeout"`
 	} `mapstructure:"server"`
+	// Admin is the listener of the metrics, kept apart from the public server. A zero port disables it.
+	Admin struct {
+		Host string `mapstructure:"host"`
+		Port int    `mapstructure:"port"`
+	} `mapstructure:"admin"`
 	DB struct {
 		Username string `mapstructure:"username"`
 		Password string `mapstructure:"password"`
@@ -40,6 +47,49 @@ type Config struct {
 		Password string `mapstructure:"password"`
 		DB       int    `mapstructure:"db"`
 	} `mapstructure:"redis"`
+	Presence struct {
+		TTL time.Duration `mapstructure:"ttl"`
+	} `mapstructure:"presence"`
+	Chat struct {
+		SendBufferSize    int           `mapstructure:"send_buffer_size"`
+		InboundBufferSize int           `mapstructure:"inbound_buffer_size"`
+		WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+		PingInterval      time.Duration `mapstructure:"ping_interval"`
+		PongTimeout       time.Duration `mapstructure:"pong_timeout"`
+		ReadIdleTimeout   time.Duration `mapstructure:"read_idle_timeout"`
+
+		CompressionModeName  string `mapstructure:"compression_mode"`
+		CompressionMode      websocket.CompressionMode
+		CompressionThreshold int      `mapstructure:"compression_threshold"`
+		OriginPatterns       []string `mapstructure:"origin_patterns"`
+		MaxMessageSize       int64    `mapstructure:"max_message_size"`
+
+		ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+
+		PersistBatchSize     int           `mapstructure:"persist_batch_size"`
+		PersistFlushInterval time.Duration `mapstructure:"persist_flush_interval"`
+		PersistQueueSize     int           `mapstructure:"persist_queue_size"`
+
+		DeliveryFlushInterval time.Duration `mapstructure:"delivery_flush_interval"`
+	} `mapstructure:"chat"`
+	RateLimit struct {
+		Rate          float64 `mapstructure:"rate"`
+		Burst         int     `mapstructure:"burst"`
+		RoomRate      float64 `mapstructure:"room_rate"`
+		RoomBurst     int     `mapstructure:"room_burst"`
+		FrameRate     float64 `mapstructure:"frame_rate"`
+		FrameBurst    int     `mapstructure:"frame_burst"`
+		MaxViolations int     `mapstructure:"max_violations"`
+		FailOpen      bool    `mapstructure:"fail_open"`
+		Rooms         []struct {
+			RoomID uint    `mapstructure:"room_id"`
+			Rate   float64 `mapstructure:"rate"`
+			Burst  int     `mapstructure:"burst"`
+		} `mapstructure:"rooms"`
+	} `mapstructure:"rate_limit"`
+	Broadcast struct {
+		Bus string `mapstructure:"bus"`
+	} `mapstructure:"broadcast"`
 	Token struct {
 		AccessKeys struct {
 			PublicKeyPath  string `mapstructure:"public_key_path"`
@@ -55,6 +105,9 @@ type Config struct {
 		} `mapstructure:"refresh_keys"`
 		AccessExpiration  time.Duration `mapstructure:"access_expiration"`
 		RefreshExpiration time.Duration `mapstructure:"refresh_expiration"`
+
+		TicketExpiration      time.Duration `mapstructure:"ticket_expiration"`
+		AllowQueryAccessToken bool          `mapstructure:"allow_query_access_token"`
 	} `mapstructure:"token"`
 }
 
@@ -62,6 +115,7 @@ func (c *Config) Parse() error {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yml")
 	viper.AddConfigPath("config")
+	setDefaults()
 
 	if err := viper.ReadInConfig(); err != nil {
 		return fmt.Errorf("Config.Parse: %w", err)
@@ -72,6 +126,15 @@ func (c *Config) Parse() error {
 		return fmt.Errorf("Config.Parse: %w", err)
 	}
 
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("Config.Parse: %w", err)
+	}
+
+	c.Chat.CompressionMode, err = parseCompressionMode(c.Chat.CompressionModeName)
+	if err != nil {
+		return fmt.Errorf("Config.Parse: %w", err)
+	}
+
 	c.Token.AccessKeys.PublicKey, err = readPublicKeyFile(c.Token.AccessKeys.PublicKeyPath)
 	if err != nil {
 		return fmt.Errorf("Config.Parse: %w", err)
@@ -93,6 +156,110 @@ func (c *Config) Parse() error {
 	return nil
 }
 
+// setDefaults sets the values of config/config.yml for the settings of the chat, so a config
+// missing them still starts with working tickers and limits.
+func setDefaults() {
+	viper.SetDefault("admin.host", "localhost")
+
+	viper.SetDefault("presence.ttl", 60*time.Second)
+
+	viper.SetDefault("chat.send_buffer_size", 256)
+	viper.SetDefault("chat.inbound_buffer_size", 256)
+	viper.SetDefault("chat.write_timeout", 10*time.Second)
+	viper.SetDefault("chat.ping_interval", 30*time.Second)
+	viper.SetDefault("chat.pong_timeout", 10*time.Second)
+	viper.SetDefault("chat.read_idle_timeout", 75*time.Second)
+	viper.SetDefault("chat.compression_mode", "no_context_takeover")
+	viper.SetDefault("chat.compression_threshold", 512)
+	viper.SetDefault("chat.max_message_size", 32768)
+	viper.SetDefault("chat.shutdown_timeout", 15*time.Second)
+	viper.SetDefault("chat.persist_batch_size", 100)
+	viper.SetDefault("chat.persist_flush_interval", 5*time.Millisecond)
+	viper.SetDefault("chat.persist_queue_size", 1024)
+	viper.SetDefault("chat.delivery_flush_interval", time.Second)
+
+	viper.SetDefault("rate_limit.rate", 5)
+	viper.SetDefault("rate_limit.burst", 20)
+	viper.SetDefault("rate_limit.room_rate", 2)
+	viper.SetDefault("rate_limit.room_burst", 10)
+	viper.SetDefault("rate_limit.frame_rate", 10)
+	viper.SetDefault("rate_limit.frame_burst", 30)
+	viper.SetDefault("rate_limit.max_violations", 10)
+	viper.SetDefault("rate_limit.fail_open", true)
+
+	viper.SetDefault("broadcast.bus", "memory")
+
+	viper.SetDefault("token.ticket_expiration", 10*time.Second)
+	viper.SetDefault("token.allow_query_access_token", false)
+}
+
+// validate rejects the intervals, sizes and rates which would stop the tickers, the queues or the token buckets.
+func (c *Config) validate() error {
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"presence.ttl", c.Presence.TTL},
+		{"chat.write_timeout", c.Chat.WriteTimeout},
+		{"chat.ping_interval", c.Chat.PingInterval},
+		{"chat.pong_timeout", c.Chat.PongTimeout},
+		{"chat.read_idle_timeout", c.Chat.ReadIdleTimeout},
+		{"chat.shutdown_timeout", c.Chat.ShutdownTimeout},
+		{"chat.persist_flush_interval", c.Chat.PersistFlushInterval},
+		{"chat.delivery_flush_interval", c.Chat.DeliveryFlushInterval},
+		{"token.ticket_expiration", c.Token.TicketExpiration},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			return fmt.Errorf("Config.validate: %s must be positive, got %s", d.name, d.value)
+		}
+	}
+
+	sizes := []struct {
+		name  string
+		value int64
+	}{
+		{"chat.send_buffer_size", int64(c.Chat.SendBufferSize)},
+		{"chat.inbound_buffer_size", int64(c.Chat.InboundBufferSize)},
+		{"chat.max_message_size", c.Chat.MaxMessageSize},
+		{"chat.persist_batch_size", int64(c.Chat.PersistBatchSize)},
+		{"chat.persist_queue_size", int64(c.Chat.PersistQueueSize)},
+		{"rate_limit.burst", int64(c.RateLimit.Burst)},
+		{"rate_limit.room_burst", int64(c.RateLimit.RoomBurst)},
+		{"rate_limit.frame_burst", int64(c.RateLimit.FrameBurst)},
+		{"rate_limit.max_violations", int64(c.RateLimit.MaxViolations)},
+	}
+	for _, s := range sizes {
+		if s.value <= 0 {
+			return fmt.Errorf("Config.validate: %s must be positive, got %d", s.name, s.value)
+		}
+	}
+	// presence is refreshed every third of its TTL, and its keys expire in Redis with a precision of seconds
+	if c.Presence.TTL < time.Second {
+		return fmt.Errorf("Config.validate: presence.ttl must be at least 1s, got %s", c.Presence.TTL)
+	}
+	if c.Chat.CompressionThreshold < 0 {
+		return fmt.Errorf("Config.validate: chat.compression_threshold must not be negative, got %d",
+			c.Chat.CompressionThreshold)
+	}
+
+	if c.RateLimit.Rate <= 0 {
+		return fmt.Errorf("Config.validate: rate_limit.rate must be positive, got %v", c.RateLimit.Rate)
+	}
+	if c.RateLimit.RoomRate <= 0 {
+		return fmt.Errorf("Config.validate: rate_limit.room_rate must be positive, got %v", c.RateLimit.RoomRate)
+	}
+	if c.RateLimit.FrameRate <= 0 {
+		return fmt.Errorf("Config.validate: rate_limit.frame_rate must be positive, got %v", c.RateLimit.FrameRate)
+	}
+	for _, room := range c.RateLimit.Rooms {
+		if room.Rate <= 0 || room.Burst <= 0 {
+			return fmt.Errorf("Config.validate: rate_limit.rooms: rate and burst of room %d must be positive", room.RoomID)
+		}
+	}
+	return nil
+}
+
 func (c *Config) GetServerConfig() *server.Config {
 	return &server.Config{
 		Addr:           fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port),
@@ -102,6 +269,19 @@ func (c *Config) GetServerConfig() *server.Config {
 	}
 }
 
+// GetAdminServerConfig returns nil if the admin listener is disabled.
+func (c *Config) GetAdminServerConfig() *server.Config {
+	if c.Admin.Port == 0 {
+		return nil
+	}
+	return &server.Config{
+		Addr:           fmt.Sprintf("%s:%d", c.Admin.Host, c.Admin.Port),
+		MaxHeaderBytes: c.Server.MaxHeaderBytes,
+		ReadTimeout:    c.Server.ReadTimeout,
+		WriteTimeout:   c.Server.WriteTimeout,
+	}
+}
+
 func (c *Config) GetDBConfig() *db.Config {
 	return &db.Config{
 		Host:     c.DB.Host,
@@ -121,6 +301,55 @@ func (c *Config) GetRedisConfig() *redis.Config {
 	}
 }
 
+func (c *Config) GetPresenceConfig() *service.PresenceConfig {
+	return &service.PresenceConfig{
+		TTL: c.Presence.TTL,
+	}
+}
+
+func (c *Config) GetChatConfig() *service.ChatConfig {
+	return &service.ChatConfig{
+		SendBuffSize:    c.Chat.SendBufferSize,
+		InboundBuffSize: c.Chat.InboundBufferSize,
+		WriteTimeout:    c.Chat.WriteTimeout,
+		PingInterval:    c.Chat.PingInterval,
+		PongTimeout:     c.Chat.PongTimeout,
+		ReadIdleTimeout: c.Chat.ReadIdleTimeout,
+
+		CompressionMode:      c.Chat.CompressionMode,
+		CompressionThreshold: c.Chat.CompressionThreshold,
+		OriginPatterns:       c.Chat.OriginPatterns,
+		MaxMessageSize:       c.Chat.MaxMessageSize,
+
+		ShutdownTimeout: c.Chat.ShutdownTimeout,
+
+		DeliveryFlushInterval: c.Chat.DeliveryFlushInterval,
+	}
+}
+
+func (c *Config) GetPersisterConfig() *service.PersisterConfig {
+	return &service.PersisterConfig{
+		BatchSize:     c.Chat.PersistBatchSize,
+		FlushInterval: c.Chat.PersistFlushInterval,
+		QueueSize:     c.Chat.PersistQueueSize,
+	}
+}
+
+func (c *Config) GetRateLimitConfig() *service.RateLimitConfig {
+	rooms := make(map[entity.ID]entity.RateLimit, len(c.RateLimit.Rooms))
+	for _, room := range c.RateLimit.Rooms {
+		rooms[entity.ID(room.RoomID)] = entity.RateLimit{Rate: room.Rate, Burst: room.Burst}
+	}
+	return &service.RateLimitConfig{
+		User:          entity.RateLimit{Rate: c.RateLimit.Rate, Burst: c.RateLimit.Burst},
+		Room:          entity.RateLimit{Rate: c.RateLimit.RoomRate, Burst: c.RateLimit.RoomBurst},
+		Rooms:         rooms,
+		Frame:         entity.RateLimit{Rate: c.RateLimit.FrameRate, Burst: c.RateLimit.FrameBurst},
+		MaxViolations: c.RateLimit.MaxViolations,
+		FailOpen:      c.RateLimit.FailOpen,
+	}
+}
+
 func (c *Config) GetTSConfig() *service.TSConfig {
 	return &service.TSConfig{
 		AccessKeys: &service.KeyPair{
@@ -136,6 +365,26 @@ func (c *Config) GetTSConfig() *service.TSConfig {
 	}
 }
 
+func (c *Config) GetTicketConfig() *service.TicketConfig {
+	return &service.TicketConfig{
+		TTL:                   c.Token.TicketExpiration,
+		AllowQueryAccessToken: c.Token.AllowQueryAccessToken,
+	}
+}
+
+func parseCompressionMode(name string) (websocket.CompressionMode, error) {
+	switch name {
+	case "disabled":
+		return websocket.CompressionDisabled, nil
+	case "context_takeover":
+		return websocket.CompressionContextTakeover, nil
+	case "no_context_takeover":
+		return websocket.CompressionNoContextTakeover, nil
+	default:
+		return 0, fmt.Errorf("parseCompressionMode: unknown compression mode %q", name)
+	}
+}
+
 func readPublicKeyFile(path string) (*rsa.PublicKey, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
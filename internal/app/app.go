@@ -1,8 +1,10 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -38,16 +40,27 @@ func Run() {
 	redis.StartRedisConnection(cfg.GetRedisConfig())
 	defer redis.CloseRedisConnection()
 
-	router := RouterFactory(logger.GetLogger(), db.GetDBConn(), redis.GetRedisConn(), cfg)
+	router, bus := RouterFactory(logger.GetLogger(), db.GetDBConn(), redis.GetRedisConn(), cfg)
 	srv := server.NewServer(cfg.GetServerConfig(), router.SetupRouter())
 
 	go func() {
-		if err := srv.Run(); err != nil {
+		if err := srv.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logMng.Fatalf("Error occured while running http server: %s", err.Error())
 			return
 		}
 	}()
 
+	var adminSrv *server.Server
+	if adminCfg := cfg.GetAdminServerConfig(); adminCfg != nil {
+		adminSrv = server.NewServer(adminCfg, router.SetupAdminRouter())
+		go func() {
+			if err := adminSrv.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logMng.Fatalf("Error occured while running admin http server: %s", err.Error())
+				return
+			}
+		}()
+	}
+
 	fmt.Println("App Started")
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -55,7 +68,27 @@ func Run() {
 	<-quit
 
 	fmt.Println("Shutting down")
-	if err := srv.Shutdown(context.Background()); err != nil {
-		logMng.Fatalf("error occurred on server shutting down: %s", err.Error())
+	shutdownTimeout := cfg.GetChatConfig().ShutdownTimeout
+	chatCtx, cancelChat := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelChat()
+	// hijacked WebSocket connections are not closed by the HTTP server
+	if err := router.Shutdown(chatCtx); err != nil {
+		logMng.Errorf("error occurred on chat shutting down: %s", err.Error())
+	}
+
+	// the chat may use up its timeout, the HTTP servers still get their own to finish the requests
+	srvCtx, cancelSrv := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelSrv()
+	if err := srv.Shutdown(srvCtx); err != nil {
+		logMng.Errorf("error occurred on server shutting down: %s", err.Error())
+	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(srvCtx); err != nil {
+			logMng.Errorf("error occurred on admin server shutting down: %s", err.Error())
+		}
+	}
+	// the bus is used by the chat and by the room requests, so it is closed once both are done
+	if err := bus.Close(); err != nil {
+		logMng.Errorf("error occurred on broadcast bus closing: %s", err.Error())
 	}
 }
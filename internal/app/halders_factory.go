@@ -7,6 +7,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"chat-server/config"
+	"chat-server/internal/domain/use_case"
 	"chat-server/internal/handlers"
 	"chat-server/internal/repository"
 	"chat-server/internal/route"
@@ -18,11 +19,27 @@ func RouterFactory(
 	conn *sql.DB,
 	redisClient *redis.Client,
 	cfg config.Config,
-) *route.Router {
-	authHandler := authHandlerFactory(logger, conn, redisClient, cfg.GetTSConfig())
-	roomHandler := roomHandlerFactory(logger, conn)
-	chatHandler := chatHandlerFactory(logger, conn)
-	return route.NewRouter(authHandler, roomHandler, chatHandler)
+) (*route.Router, use_case.BroadcastBus) {
+	authHandler := authHandlerFactory(
+		logger,
+		conn,
+		redisClient,
+		cfg.GetTSConfig(),
+		cfg.GetTicketConfig(),
+	)
+	bus := broadcastBusFactory(logger, redisClient, cfg.Broadcast.Bus)
+	roomHandler := roomHandlerFactory(logger, conn, bus)
+	chatHandler := chatHandlerFactory(
+		logger,
+		conn,
+		redisClient,
+		bus,
+		cfg.GetChatConfig(),
+		cfg.GetPresenceConfig(),
+		cfg.GetPersisterConfig(),
+		cfg.GetRateLimitConfig(),
+	)
+	return route.NewRouter(authHandler, roomHandler, chatHandler), bus
 }
 
 func authHandlerFactory(
@@ -30,27 +47,87 @@ func authHandlerFactory(
 	conn *sql.DB,
 	redisClient *redis.Client,
 	tsConfig *service.TSConfig,
+	ticketConfig *service.TicketConfig,
 ) *handlers.AuthHandler {
 	userRep := repository.NewUserRepository(conn)
 	userCacheRep := repository.NewUserCacheRepository(redisClient)
 	tokenCacheRep := repository.NewTokenCacheRepository(redisClient)
+	ticketRep := repository.NewTicketRepository(redisClient)
 
 	userSvc := service.NewUserService(userRep, userCacheRep)
 	tokenSvc := service.NewTokenService(tsConfig, tokenCacheRep)
 	authSvc := service.NewAuthService(userSvc, tokenSvc)
+	ticketSvc := service.NewTicketService(ticketConfig, ticketRep)
 
-	return handlers.NewAuthHandler(userSvc, authSvc, tokenSvc, logger)
+	return handlers.NewAuthHandler(
+		userSvc,
+		authSvc,
+		tokenSvc,
+		ticketSvc,
+		ticketConfig.AllowQueryAccessToken,
+		logger,
+	)
 }
 
-func roomHandlerFactory(logger *logrus.Logger, conn *sql.DB) *handlers.RoomHandler {
+func roomHandlerFactory(logger *logrus.Logger, conn *sql.DB, bus use_case.BroadcastBus) *handlers.RoomHandler {
 	roomRep := repository.NewRoomRepository(conn)
 	memberRep := repository.NewMemberRepository(conn)
 	roomSvc := service.NewRoomService(roomRep, memberRep)
-	return handlers.NewRoomHandler(roomSvc, logger)
+	return handlers.NewRoomHandler(roomSvc, bus, logger)
 }
 
-func chatHandlerFactory(logger *logrus.Logger, conn *sql.DB) *handlers.ChatHandler {
+func broadcastBusFactory(
+	logger *logrus.Logger,
+	redisClient *redis.Client,
+	busType string,
+) use_case.BroadcastBus {
+	switch busType {
+	case "", "memory":
+		return service.NewMemoryBroadcastBus()
+	case "redis":
+		return service.NewRedisBroadcastBus(redisClient)
+	default:
+		logger.Fatalf("unknown broadcast bus: %s", busType)
+		return nil
+	}
+}
+
+func chatHandlerFactory(
+	logger *logrus.Logger,
+	conn *sql.DB,
+	redisClient *redis.Client,
+	bus use_case.BroadcastBus,
+	chatConfig *service.ChatConfig,
+	presenceConfig *service.PresenceConfig,
+	persisterConfig *service.PersisterConfig,
+	rateLimitConfig *service.RateLimitConfig,
+) *handlers.ChatHandler {
 	msgRep := repository.NewMessageRepository(conn)
-	messageSvc := service.NewMessageService(msgRep)
-	return handlers.NewChatHandler(messageSvc, logger)
+	readCursorRep := repository.NewReadCursorRepository(conn)
+	deliveryCursorRep := repository.NewDeliveryCursorRepository(conn)
+	reactionRep := repository.NewReactionRepository(conn)
+	pinRep := repository.NewPinRepository(conn)
+	roomRep := repository.NewRoomRepository(conn)
+	memberRep := repository.NewMemberRepository(conn)
+	presenceCacheRep := repository.NewPresenceCacheRepository(redisClient)
+	rateLimitRep := repository.NewRateLimitRepository(redisClient)
+
+	messageSvc := service.NewMessageService(msgRep, readCursorRep, deliveryCursorRep, reactionRep, pinRep)
+	roomSvc := service.NewRoomService(roomRep, memberRep)
+	presenceSvc := service.NewPresenceService(presenceConfig, presenceCacheRep)
+	rateLimitSvc := service.NewRateLimitService(rateLimitConfig, rateLimitRep)
+
+	return handlers.NewChatHandler(
+		messageSvc,
+		roomSvc,
+		presenceSvc,
+		presenceConfig.RefreshInterval(),
+		bus,
+		persisterConfig,
+		rateLimitSvc,
+		rateLimitConfig.Frame,
+		rateLimitConfig.MaxViolations,
+		chatConfig,
+		logger,
+	)
 }
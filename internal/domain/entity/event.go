@@ -0,0 +1,246 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxClientNonceLength is the maximal length of a client nonce, enough for a UUID in any notation.
+const MaxClientNonceLength = 64
+
+var ErrClientNonceLength = errors.New("nonce must be at most 64 characters long")
+
+// MaxEphemeralKindLength is the maximal length of the kind of an ephemeral message.
+const MaxEphemeralKindLength = 64
+
+var ErrEphemeralKindLength = errors.New("kind must be at most 64 characters long")
+
+// ProtocolVersion is the version of the WebSocket event envelope understood by the server.
+const ProtocolVersion = 1
+
+type EventType string
+
+const (
+	EventMessageNew     EventType = "message.new"
+	EventMessageEdited  EventType = "message.edited"
+	EventMessageDeleted EventType = "message.deleted"
+	EventMessageRead    EventType = "message.read"
+	EventTypingStarted  EventType = "typing.started"
+	EventTypingStopped  EventType = "typing.stopped"
+	EventPresenceUpdate EventType = "presence.update"
+	EventPresenceChange EventType = "presence.changed"
+	EventError          EventType = "error"
+
+	// EventMessageEphemeral is fanned out to the clients currently in the room and never persisted
+	EventMessageEphemeral EventType = "message.ephemeral"
+	// EventMessageDelivered is published when the messages of a room are delivered to a recipient
+	EventMessageDelivered EventType = "message.delivered"
+	// EventThreadReply carries a new message replying in a thread, so clients can tell it from the messages of the room
+	EventThreadReply EventType = "thread.reply"
+	// EventReactionAdded and EventReactionRemoved carry a reaction changed by a user of the room
+	EventReactionAdded   EventType = "reaction.added"
+	EventReactionRemoved EventType = "reaction.removed"
+	// EventMessagePinned and EventMessageUnpinned carry a pin changed by the owner of the room
+	EventMessagePinned   EventType = "message.pinned"
+	EventMessageUnpinned EventType = "message.unpinned"
+	// EventReplayTruncated ends a replay of missed messages cut short, the rest is fetched through REST
+	EventReplayTruncated EventType = "replay.truncated"
+
+	EventRoomSubscribe    EventType = "room.subscribe"
+	EventRoomUnsubscribe  EventType = "room.unsubscribe"
+	EventRoomSubscribed   EventType = "room.subscribed"
+	EventRoomUnsubscribed EventType = "room.unsubscribed"
+	// EventRoomUpdated carries the settings of a room changed by its owner
+	EventRoomUpdated EventType = "room.updated"
+
+	EventServerGoingAway EventType = "server.going_away"
+)
+
+type ErrorCode string
+
+const (
+	ErrCodeMalformedFrame     ErrorCode = "malformed_frame"
+	ErrCodeUnsupportedVersion ErrorCode = "unsupported_version"
+	ErrCodeUnknownType        ErrorCode = "unknown_type"
+	ErrCodeInvalidPayload     ErrorCode = "invalid_payload"
+	ErrCodeInternal           ErrorCode = "internal_error"
+	ErrCodeForbidden          ErrorCode = "forbidden"
+	ErrCodeNotSubscribed      ErrorCode = "not_subscribed"
+	ErrCodeRateLimited        ErrorCode = "rate_limited"
+)
+
+// ProtocolError is returned to the client as an error frame instead of closing the connection.
+type ProtocolError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func NewProtocolError(code ErrorCode, format string, args ...interface{}) *ProtocolError {
+	return &ProtocolError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Event is the envelope of every frame sent by the server over a chat WebSocket.
+// Seq is the ID of the message a message.new or thread.reply event carries, a client reconnects
+// with the last one it has seen to receive the missed messages.
+type Event struct {
+	Version int         `json:"v"`
+	Type    EventType   `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	RoomID  ID          `json:"room_id,omitempty"`
+	Seq     ID          `json:"seq,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+
+	// ExceptUserID excludes the clients of the user from the delivery; it is never sent to clients
+	ExceptUserID ID `json:"-"`
+	// ToUserID limits the delivery to the clients of the user; it is never sent to clients
+	ToUserID ID `json:"-"`
+	// SenderID is the sender of the message carried by the event, whose own clients do not count
+	// as recipients; it is never sent to clients
+	SenderID ID `json:"-"`
+}
+
+func NewEvent(eventType EventType, payload interface{}) *Event {
+	return &Event{
+		Version: ProtocolVersion,
+		Type:    eventType,
+		Payload: payload,
+	}
+}
+
+// NewErrorEvent builds an error frame answering the inbound event with the given ID.
+func NewErrorEvent(id string, err *ProtocolError) *Event {
+	ev := NewEvent(EventError, &ErrorPayload{Code: err.Code, Message: err.Message})
+	ev.ID = id
+	return ev
+}
+
+// InboundEvent is the envelope of a frame received from a client, decoded by the codec of its connection.
+// Its payload is decoded only after the type is known.
+// RoomID may be omitted by a client joined to a single room.
+type InboundEvent struct {
+	Version int
+	Type    EventType
+	ID      string
+	RoomID  ID
+	Payload []byte
+
+	// UnmarshalPayload decodes the payload in the wire format of the codec
+	UnmarshalPayload func(data []byte, v interface{}) error
+}
+
+func (e *InboundEvent) Validate() error {
+	if e.Version != ProtocolVersion {
+		return NewProtocolError(
+			ErrCodeUnsupportedVersion,
+			"unsupported protocol version %d, expected %d",
+			e.Version,
+			ProtocolVersion,
+		)
+	}
+	if e.Type == "" {
+		return NewProtocolError(ErrCodeMalformedFrame, "event type is empty")
+	}
+	return nil
+}
+
+// DecodePayload unmarshals the payload into v and validates it.
+func (e *InboundEvent) DecodePayload(v ValidateTypes) error {
+	if len(e.Payload) == 0 {
+		return NewProtocolError(ErrCodeInvalidPayload, "payload is empty")
+	}
+	if err := e.UnmarshalPayload(e.Payload, v); err != nil {
+		return NewProtocolError(ErrCodeInvalidPayload, "%v", err)
+	}
+	if err := v.Validate(); err != nil {
+		return NewProtocolError(ErrCodeInvalidPayload, "%v", err)
+	}
+	return nil
+}
+
+// NewMessagePayload is a message sent by a client. Nonce is optional, a client retrying the send
+// with the same nonce receives the message created by the first attempt. ParentID is optional too,
+// the message replies in the thread of the parent message then.
+type NewMessagePayload struct {
+	Content  NonEmptyString `json:"content"`
+	Nonce    string         `json:"nonce"`
+	ParentID ID             `json:"parent_id"`
+}
+
+func (n *NewMessagePayload) Validate() error {
+	if err := n.Content.Validate(); err != nil {
+		return err
+	}
+	if len(n.Nonce) > MaxClientNonceLength {
+		return ErrClientNonceLength
+	}
+	return nil
+}
+
+// EphemeralMessagePayload is an ephemeral message sent by a client, such as a bot status,
+// a screen sharing notice or a live cursor position. Kind lets clients tell them apart.
+type EphemeralMessagePayload struct {
+	Kind    string         `json:"kind"`
+	Content NonEmptyString `json:"content"`
+}
+
+func (e *EphemeralMessagePayload) Validate() error {
+	if err := e.Content.Validate(); err != nil {
+		return err
+	}
+	if len(e.Kind) > MaxEphemeralKindLength {
+		return ErrEphemeralKindLength
+	}
+	return nil
+}
+
+// EphemeralMessage is fanned out to the other clients of the room. It has no ID,
+// since it is never stored, and it is not replayed to clients joining later.
+type EphemeralMessage struct {
+	RoomID   ID             `json:"room_id"`
+	SenderID ID             `json:"sender_id"`
+	Kind     string         `json:"kind,omitempty"`
+	Content  NonEmptyString `json:"content"`
+	SentAt   time.Time      `json:"sent_at"`
+}
+
+type MessageDeletedPayload struct {
+	ID     ID `json:"id"`
+	RoomID ID `json:"room_id"`
+}
+
+type TypingPayload struct {
+	RoomID ID `json:"room_id"`
+	UserID ID `json:"user_id"`
+}
+
+// RoomSubscribePayload is the optional payload of a subscription. A client resubscribing
+// after a reconnect passes the last message ID it has seen to receive the missed messages.
+type RoomSubscribePayload struct {
+	Since ID `json:"since"`
+}
+
+func (r *RoomSubscribePayload) Validate() error {
+	return nil
+}
+
+// ReplayTruncatedPayload points to the history of the room following the last replayed message,
+// which the client pages through with the after cursor of the room messages endpoint.
+type ReplayTruncatedPayload struct {
+	After MessageCursor `json:"after"`
+}
+
+// GoingAwayPayload tells a client how long to wait before reconnecting to another server instance,
+// so the clients of a shutting down instance do not reconnect all at once.
+type GoingAwayPayload struct {
+	ReconnectAfterMs int64 `json:"reconnect_after_ms"`
+}
+
+type ErrorPayload struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
@@ -1,6 +1,24 @@
 package entity
 
-import "time"
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// DefaultMessagePageLimit and MaxMessagePageLimit bound the number of messages on a page of a room history.
+const (
+	DefaultMessagePageLimit = 50
+	MaxMessagePageLimit     = 100
+)
+
+var (
+	ErrThreadParentRoom = errors.New("parent message must be in the same room")
+	ErrInvalidCursor    = errors.New("cursor is invalid")
+	ErrCursorConflict   = errors.New("before and after cannot be used together")
+	ErrMessagePageLimit = errors.New("limit must be at most 100")
+)
 
 type Message struct {
 	ID        ID             `json:"id"`
@@ -12,22 +30,98 @@ type Message struct {
 	UpdatedAt *time.Time     `json:"updated_at"`
 	DeletedAt *time.Time     `json:"deleted_at"`
 	IsActive  bool           `json:"is_active"`
+	ReadBy    []ID           `json:"read_by,omitempty"`
+	ReadCount int            `json:"read_count"`
+	// DeliveredTo are the recipients the message has been delivered to, the readers included
+	DeliveredTo    []ID `json:"delivered_to,omitempty"`
+	DeliveredCount int  `json:"delivered_count"`
+	// ClientNonce is generated by the sender to recognize the message when the send is retried
+	ClientNonce string `json:"client_nonce,omitempty"`
+	// ParentID is the message starting the thread the message replies in, zero for a message of the room
+	ParentID ID `json:"parent_id,omitempty"`
+	// ReplyCount and LastReplyAt summarize the thread started by the message
+	ReplyCount  int        `json:"reply_count,omitempty"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+	// Edited is set once the content has been edited, every previous content is kept as a revision
+	Edited        bool `json:"edited"`
+	RevisionCount int  `json:"revision_count"`
+	// Reactions are counted per emoji in the order the emojis were first used
+	Reactions []ReactionCount `json:"reactions,omitempty"`
+}
+
+// SetReadBy fills the recipients who have read the message according to the read cursors of its room.
+func (m *Message) SetReadBy(cursors []ReadCursor) {
+	m.ReadBy = nil
+	for _, cursor := range cursors {
+		if cursor.UserID != m.SenderID && cursor.LastReadMessageID >= m.ID {
+			m.ReadBy = append(m.ReadBy, cursor.UserID)
+		}
+	}
+	m.ReadCount = len(m.ReadBy)
+}
+
+// SetDeliveredTo fills the recipients the message has been delivered to according to the delivery cursors of its room.
+func (m *Message) SetDeliveredTo(cursors []DeliveryCursor) {
+	m.DeliveredTo = nil
+	for _, cursor := range cursors {
+		if cursor.UserID != m.SenderID && cursor.LastDeliveredMessageID >= m.ID {
+			m.DeliveredTo = append(m.DeliveredTo, cursor.UserID)
+		}
+	}
+	m.DeliveredCount = len(m.DeliveredTo)
+}
+
+// SetThreadSummary fills the reply count and the last reply time of the message from the summaries of the threads.
+func (m *Message) SetThreadSummary(summaries map[ID]ThreadSummary) {
+	summary, ok := summaries[m.ID]
+	if !ok {
+		m.ReplyCount = 0
+		m.LastReplyAt = nil
+		return
+	}
+	m.ReplyCount = summary.ReplyCount
+	m.LastReplyAt = summary.LastReplyAt
+}
+
+// SetReactions fills the reaction counts of the message from the counts of the messages selected with it.
+func (m *Message) SetReactions(reactions map[ID][]ReactionCount) {
+	m.Reactions = reactions[m.ID]
+}
+
+// ThreadSummary counts the active replies of the thread started by the parent message.
+type ThreadSummary struct {
+	ParentID    ID
+	ReplyCount  int
+	LastReplyAt *time.Time
 }
 
 type CreateMessageReq struct {
-	SenderID ID             `json:"sender_id"`
-	RoomID   ID             `json:"room_id"`
-	Content  NonEmptyString `json:"content"`
+	SenderID    ID             `json:"sender_id"`
+	RoomID      ID             `json:"room_id"`
+	Content     NonEmptyString `json:"content"`
+	ClientNonce string         `json:"client_nonce"`
+	ParentID    ID             `json:"parent_id"`
 }
 
 func NewCreateMessageReq(message *Message) *CreateMessageReq {
 	return &CreateMessageReq{
-		SenderID: message.SenderID,
-		RoomID:   message.RoomID,
-		Content:  message.Content,
+		SenderID:    message.SenderID,
+		RoomID:      message.RoomID,
+		Content:     message.Content,
+		ClientNonce: message.ClientNonce,
+		ParentID:    message.ParentID,
 	}
 }
 
+// CreateMessageRes is the result of creating one message of a bulk. Created is false
+// if a message with the same client nonce has been sent before and is returned instead.
+// Err is set instead of the message if the message sent before cannot be returned.
+type CreateMessageRes struct {
+	Message *Message
+	Created bool
+	Err     error
+}
+
 type EditMessageReq struct {
 	ID      ID             `json:"id"`
 	Content NonEmptyString `json:"content"`
@@ -43,15 +137,103 @@ func (e *EditMessageReq) Validate() error {
 	return nil
 }
 
+// MessageCursor is an opaque position in the history of a room, handed out with a page of its messages.
+type MessageCursor string
+
+func NewMessageCursor(id ID) MessageCursor {
+	return MessageCursor(base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10))))
+}
+
+// MessageID returns the ID of the message the cursor points at, zero for an empty cursor.
+func (c MessageCursor) MessageID() (ID, error) {
+	if c == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(string(data), 10, 0)
+	if err != nil || id == 0 {
+		return 0, ErrInvalidCursor
+	}
+	return ID(id), nil
+}
+
+// GetMessageBulkPaginateReq pages through the history of the room, the newest messages first.
+// Before continues with older messages and After with newer ones, without them the latest messages are returned.
 type GetMessageBulkPaginateReq struct {
-	RoomID  ID   `json:"room_id"`
-	PerPage uint `json:"per_page"`
-	Page    uint `json:"page"`
+	RoomID ID            `form:"-"`
+	Limit  uint          `form:"limit"`
+	Before MessageCursor `form:"before"`
+	After  MessageCursor `form:"after"`
+	// UserID is the user the messages are returned to, whose reactions are flagged
+	UserID ID `form:"-"`
 }
 
 func (g *GetMessageBulkPaginateReq) Validate() error {
 	if err := g.RoomID.Validate(); err != nil {
 		return err
 	}
+	if g.Limit > MaxMessagePageLimit {
+		return ErrMessagePageLimit
+	}
+	if g.Before != "" && g.After != "" {
+		return ErrCursorConflict
+	}
+	if _, err := g.Before.MessageID(); err != nil {
+		return err
+	}
+	if _, err := g.After.MessageID(); err != nil {
+		return err
+	}
 	return nil
 }
+
+// MessagePage is a page of the history of a room, the newest messages first. NextCursor continues
+// with older messages and PrevCursor with newer ones, each of them is set only if there are such messages.
+type MessagePage struct {
+	Messages   []Message     `json:"messages"`
+	NextCursor MessageCursor `json:"next_cursor,omitempty"`
+	PrevCursor MessageCursor `json:"prev_cursor,omitempty"`
+}
+
+// GetThreadReq pages through the replies of the thread started by the parent message, oldest first.
+// After continues with the replies following the cursor, without it the first replies are returned.
+type GetThreadReq struct {
+	ParentID ID            `form:"-"`
+	Limit    uint          `form:"limit"`
+	After    MessageCursor `form:"after"`
+	// UserID is the user the messages are returned to, whose reactions are flagged
+	UserID ID `form:"-"`
+}
+
+func (g *GetThreadReq) Validate() error {
+	if err := g.ParentID.Validate(); err != nil {
+		return err
+	}
+	if g.Limit > MaxMessagePageLimit {
+		return ErrMessagePageLimit
+	}
+	if _, err := g.After.MessageID(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Thread is the parent message, with the summary of the thread, followed by a page of its replies.
+// NextCursor continues with the later replies, it is set only if there are such replies.
+type Thread struct {
+	Parent     *Message      `json:"parent"`
+	Replies    []Message     `json:"replies"`
+	NextCursor MessageCursor `json:"next_cursor,omitempty"`
+}
+
+// MessageRevision is a previous content of a message. Revision 1 is the content the message was sent with.
+type MessageRevision struct {
+	MessageID  ID             `json:"message_id"`
+	Revision   int            `json:"revision"`
+	Content    NonEmptyString `json:"content"`
+	WrittenAt  *time.Time     `json:"written_at"`
+	ReplacedAt *time.Time     `json:"replaced_at"`
+}
@@ -0,0 +1,67 @@
+package entity
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestMessageCursor(t *testing.T) {
+	for _, id := range []ID{1, 42, 1<<63 - 1} {
+		cursor := NewMessageCursor(id)
+		got, err := cursor.MessageID()
+		if err != nil || got != id {
+			t.Fatalf("NewMessageCursor(%d).MessageID() = %d, %v", id, got, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cursor  MessageCursor
+		wantID  ID
+		wantErr error
+	}{
+		{"empty", "", 0, nil},
+		{"not base64", "!!!", 0, ErrInvalidCursor},
+		{"padded base64", MessageCursor(base64.URLEncoding.EncodeToString([]byte("1"))), 0, ErrInvalidCursor},
+		{"not a number", MessageCursor(base64.RawURLEncoding.EncodeToString([]byte("abc"))), 0, ErrInvalidCursor},
+		{"negative", MessageCursor(base64.RawURLEncoding.EncodeToString([]byte("-1"))), 0, ErrInvalidCursor},
+		{"zero", MessageCursor(base64.RawURLEncoding.EncodeToString([]byte("0"))), 0, ErrInvalidCursor},
+		{"plain ID", "42", 0, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cursor.MessageID()
+			if got != tt.wantID || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MessageID() = %d, %v, want %d, %v", got, err, tt.wantID, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetMessageBulkPaginateReqValidate(t *testing.T) {
+	cursor := NewMessageCursor(10)
+
+	tests := []struct {
+		name    string
+		req     GetMessageBulkPaginateReq
+		wantErr error
+	}{
+		{"latest page", GetMessageBulkPaginateReq{RoomID: 1}, nil},
+		{"max limit", GetMessageBulkPaginateReq{RoomID: 1, Limit: MaxMessagePageLimit}, nil},
+		{"limit over max", GetMessageBulkPaginateReq{RoomID: 1, Limit: MaxMessagePageLimit + 1}, ErrMessagePageLimit},
+		{"before", GetMessageBulkPaginateReq{RoomID: 1, Before: cursor}, nil},
+		{"after", GetMessageBulkPaginateReq{RoomID: 1, After: cursor}, nil},
+		{"before and after", GetMessageBulkPaginateReq{RoomID: 1, Before: cursor, After: cursor}, ErrCursorConflict},
+		{"invalid before", GetMessageBulkPaginateReq{RoomID: 1, Before: "!"}, ErrInvalidCursor},
+		{"invalid after", GetMessageBulkPaginateReq{RoomID: 1, After: "!"}, ErrInvalidCursor},
+		{"zero room", GetMessageBulkPaginateReq{}, ErrZeroID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrPinMessageRoom = errors.New("message is not in the room")
+
+// Pin is a message pinned in its room.
+type Pin struct {
+	RoomID    ID         `json:"room_id"`
+	MessageID ID         `json:"message_id"`
+	PinnedBy  ID         `json:"pinned_by,omitempty"`
+	PinnedAt  *time.Time `json:"pinned_at,omitempty"`
+	Message   *Message   `json:"message,omitempty"`
+}
+
+type PinReq struct {
+	RoomID    ID `json:"room_id"`
+	MessageID ID `json:"message_id"`
+	UserID    ID `json:"user_id"`
+}
+
+func (p *PinReq) Validate() error {
+	if err := p.RoomID.Validate(); err != nil {
+		return err
+	}
+	if err := p.MessageID.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package entity
+
+import "errors"
+
+var ErrInvalidPresenceStatus = errors.New("invalid presence status")
+
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+type Presence struct {
+	UserID ID             `json:"user_id"`
+	Status PresenceStatus `json:"status"`
+}
+
+// PresenceUpdatePayload is sent by a client to switch between online and away.
+// Offline cannot be set explicitly: it follows from closing all connections.
+type PresenceUpdatePayload struct {
+	Status PresenceStatus `json:"status"`
+}
+
+func (p *PresenceUpdatePayload) Validate() error {
+	if p.Status != PresenceOnline && p.Status != PresenceAway {
+		return ErrInvalidPresenceStatus
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+package entity
+
+// RateLimit is a token bucket refilled with Rate tokens per second up to Burst tokens.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
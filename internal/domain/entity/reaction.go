@@ -0,0 +1,175 @@
+package entity
+
+import (
+	"errors"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxEmojiLength is the maximal length of an emoji in bytes, enough for a family or a flag sequence.
+const MaxEmojiLength = 32
+
+var ErrInvalidEmoji = errors.New("emoji must be a single emoji of at most 32 bytes")
+
+// emojiTable holds the Unicode ranges of the emoji pictographs.
+var emojiTable = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00a9, Stride: 1},
+		{Lo: 0x00ae, Hi: 0x00ae, Stride: 1},
+		{Lo: 0x203c, Hi: 0x203c, Stride: 1},
+		{Lo: 0x2049, Hi: 0x2049, Stride: 1},
+		{Lo: 0x2122, Hi: 0x2122, Stride: 1},
+		{Lo: 0x2139, Hi: 0x2139, Stride: 1},
+		{Lo: 0x2194, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x2300, Hi: 0x23ff, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25a0, Hi: 0x25ff, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b00, Hi: 0x2bff, Stride: 1},
+		{Lo: 0x3030, Hi: 0x3030, Stride: 1},
+		{Lo: 0x303d, Hi: 0x303d, Stride: 1},
+		{Lo: 0x3297, Hi: 0x3297, Stride: 1},
+		{Lo: 0x3299, Hi: 0x3299, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1faff, Stride: 1},
+	},
+	LatinOffset: 2,
+}
+
+const (
+	zeroWidthJoiner = '\u200d'
+	keycap          = '\u20e3'
+	textStyle       = '\ufe0e'
+	emojiStyle      = '\ufe0f'
+	cancelTag       = '\U000e007f'
+)
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+func isSkinTone(r rune) bool {
+	return r >= 0x1f3fb && r <= 0x1f3ff
+}
+
+func isTag(r rune) bool {
+	return r >= 0xe0020 && r <= 0xe007e
+}
+
+// Emoji is a single emoji, possibly a sequence of pictographs joined or modified
+// by skin tones, variation selectors and tags, such as a family or a flag.
+type Emoji string
+
+// Validate accepts a single emoji: a flag of two regional indicators, a keycap of a digit, '#' or '*',
+// or pictographs of the Unicode emoji ranges with their modifiers joined by zero width joiners.
+func (e Emoji) Validate() error {
+	if e == "" || len(e) > MaxEmojiLength || !utf8.ValidString(string(e)) {
+		return ErrInvalidEmoji
+	}
+
+	runes := []rune(string(e))
+	for i := 0; ; i++ {
+		n := emojiElementLength(runes[i:])
+		if n == 0 {
+			return ErrInvalidEmoji
+		}
+		i += n
+		if i == len(runes) {
+			return nil
+		}
+		if runes[i] != zeroWidthJoiner {
+			return ErrInvalidEmoji
+		}
+	}
+}
+
+// emojiElementLength returns the number of runes of the emoji starting the runes,
+// which may be joined to the next one, or zero if they do not start with an emoji.
+func emojiElementLength(runes []rune) int {
+	if len(runes) == 0 {
+		return 0
+	}
+
+	r := runes[0]
+	n := 1
+	switch {
+	case isRegionalIndicator(r):
+		if n < len(runes) && isRegionalIndicator(runes[n]) {
+			return n + 1
+		}
+		return 0
+	case r >= '0' && r <= '9', r == '#', r == '*':
+		if n < len(runes) && runes[n] == emojiStyle {
+			n++
+		}
+		if n < len(runes) && runes[n] == keycap {
+			return n + 1
+		}
+		return 0
+	case unicode.Is(emojiTable, r) && !isSkinTone(r):
+		// a skin tone only modifies the pictograph before it
+		if n < len(runes) && (runes[n] == textStyle || runes[n] == emojiStyle) {
+			n++
+		}
+		if n < len(runes) && isSkinTone(runes[n]) {
+			n++
+		}
+		if n < len(runes) && runes[n] == emojiStyle {
+			n++
+		}
+		tags := n
+		for n < len(runes) && isTag(runes[n]) {
+			n++
+		}
+		if n == tags {
+			return n
+		}
+		if n < len(runes) && runes[n] == cancelTag {
+			return n + 1
+		}
+		return 0
+	}
+	return 0
+}
+
+type ReactionReq struct {
+	MessageID ID    `json:"message_id"`
+	UserID    ID    `json:"user_id"`
+	Emoji     Emoji `json:"emoji"`
+}
+
+func (r *ReactionReq) Validate() error {
+	if err := r.MessageID.Validate(); err != nil {
+		return err
+	}
+	if err := r.Emoji.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReactionChange is a reaction added or removed by the user, with the number of users
+// who have reacted to the message with the same emoji after the change.
+type ReactionChange struct {
+	MessageID ID    `json:"message_id"`
+	RoomID    ID    `json:"room_id"`
+	UserID    ID    `json:"user_id"`
+	Emoji     Emoji `json:"emoji"`
+	Count     int   `json:"count"`
+}
+
+// ReactionCount is the number of users who have reacted to a message with the emoji.
+// ReactedByMe reports whether the user the message is returned to is one of them.
+type ReactionCount struct {
+	Emoji       Emoji `json:"emoji"`
+	Count       int   `json:"count"`
+	ReactedByMe bool  `json:"reacted_by_me"`
+}
+
+// MessageReactionCount is the reaction count of one of the messages selected in bulk.
+type MessageReactionCount struct {
+	MessageID ID
+	ReactionCount
+}
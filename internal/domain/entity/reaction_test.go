@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEmojiValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		emoji Emoji
+		valid bool
+	}{
+		{"pictograph", "\U0001f44d", true},
+		{"pictograph with emoji style", "\u2764\ufe0f", true},
+		{"skin tone", "\U0001f44d\U0001f3fd", true},
+		{"family", "\U0001f468\u200d\U0001f469\u200d\U0001f467\u200d\U0001f466", true},
+		{"family with skin tones", "\U0001f469\U0001f3fb\u200d\U0001f91d\u200d\U0001f468\U0001f3ff", true},
+		{"flag", "\U0001f1fa\U0001f1e6", true},
+		{"keycap", "1\ufe0f\u20e3", true},
+		{"keycap without emoji style", "#\u20e3", true},
+		{"tag sequence", "\U0001f3f4\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f", true},
+		{"empty", "", false},
+		{"plain text", "ok", false},
+		{"letter with emoji", "a\U0001f44d", false},
+		{"two emoji", "\U0001f44d\U0001f44e", false},
+		{"two flags", "\U0001f1fa\U0001f1e6\U0001f1fa\U0001f1f8", false},
+		{"lone regional indicator", "\U0001f1fa", false},
+		{"lone skin tone", "\U0001f3fd", false},
+		{"skin tone joined", "\U0001f468\u200d\U0001f3fd", false},
+		{"digit without keycap", "1", false},
+		{"trailing joiner", "\U0001f468\u200d", false},
+		{"leading joiner", "\u200d\U0001f468", false},
+		{"unterminated tag sequence", "\U0001f3f4\U000e0067\U000e0062", false},
+		{"too long", "\U0001f468\u200d\U0001f469\u200d\U0001f467\u200d\U0001f466\u200d\U0001f468\u200d\U0001f469", false},
+		{"invalid UTF-8", "\xff", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.emoji.Validate()
+			if tt.valid && err != nil {
+				t.Fatalf("Validate(%q) = %v, want nil", tt.emoji, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidEmoji) {
+				t.Fatalf("Validate(%q) = %v, want %v", tt.emoji, err, ErrInvalidEmoji)
+			}
+		})
+	}
+}
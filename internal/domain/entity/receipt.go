@@ -0,0 +1,55 @@
+package entity
+
+import "time"
+
+// ReadCursor is the last message of the room read by the user.
+// Every message of the room up to it is considered read by the user.
+type ReadCursor struct {
+	RoomID            ID         `json:"room_id"`
+	UserID            ID         `json:"user_id"`
+	LastReadMessageID ID         `json:"last_read_message_id"`
+	UpdatedAt         *time.Time `json:"updated_at"`
+}
+
+// DeliveryCursor is the last message of the room delivered to the user, either written
+// to a connection of the user or fetched through pagination. Every message of the room
+// up to it is considered delivered to the user.
+type DeliveryCursor struct {
+	RoomID                 ID         `json:"room_id"`
+	UserID                 ID         `json:"user_id"`
+	LastDeliveredMessageID ID         `json:"last_delivered_message_id"`
+	UpdatedAt              *time.Time `json:"updated_at"`
+}
+
+// ReceiptCounts are the numbers of the recipients of the message it has been delivered to
+// and read by, out of all recipients in its room.
+type ReceiptCounts struct {
+	MessageID      ID  `json:"message_id"`
+	DeliveredCount int `json:"delivered_count"`
+	ReadCount      int `json:"read_count"`
+	RecipientCount int `json:"recipient_count"`
+}
+
+// DeliveryReceipt is published to the room when the delivery cursor of a user moves.
+type DeliveryReceipt struct {
+	DeliveryCursor
+	ReceiptCounts
+}
+
+// ReadReceipt is published to the room when the read cursor of a user moves.
+type ReadReceipt struct {
+	ReadCursor
+	ReceiptCounts
+}
+
+// ReadUpToPayload is sent by a client to mark messages of the room as read up to the given one.
+type ReadUpToPayload struct {
+	MessageID ID `json:"message_id"`
+}
+
+func (r *ReadUpToPayload) Validate() error {
+	if err := r.MessageID.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
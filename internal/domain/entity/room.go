@@ -5,6 +5,8 @@ type Room struct {
 	OwnerID ID       `json:"owner_id"`
 	Name    string   `json:"name"`
 	Members []Member `json:"members"`
+	// AllowEphemeral permits the ephemeral messages, which are fanned out but never stored
+	AllowEphemeral bool `json:"allow_ephemeral"`
 }
 
 type CreateRoomReq struct {
@@ -13,17 +15,21 @@ type CreateRoomReq struct {
 }
 
 type CreateRoomRes struct {
-	ID      ID     `json:"id"`
-	OwnerID ID     `json:"owner_id"`
-	Name    string `json:"name"`
+	ID             ID     `json:"id"`
+	OwnerID        ID     `json:"owner_id"`
+	Name           string `json:"name"`
+	AllowEphemeral bool   `json:"allow_ephemeral"`
 }
 
+// EditRoomReq changes the fields of the room which are set, the others keep their values.
 type EditRoomReq struct {
-	ID   ID     `json:"id"`
-	Name string `json:"name"`
+	ID             ID     `json:"id"`
+	Name           string `json:"name"`
+	AllowEphemeral *bool  `json:"allow_ephemeral"`
 }
 
 type EditRoomRes struct {
-	ID   ID     `json:"id"`
-	Name string `json:"name"`
+	ID             ID     `json:"id"`
+	Name           string `json:"name"`
+	AllowEphemeral bool   `json:"allow_ephemeral"`
 }
@@ -0,0 +1,20 @@
+package entity
+
+// Ticket authenticates the opening of one chat WebSocket instead of an access token in the URL,
+// which would end up in proxy and access logs. RoomID is the only room the ticket can join,
+// a ticket without a room opens /ws.
+type Ticket struct {
+	Value    string         `json:"-"`
+	UserID   ID             `json:"user_id"`
+	Username NonEmptyString `json:"username"`
+	RoomID   ID             `json:"room_id"`
+}
+
+type CreateTicketReq struct {
+	RoomID ID `json:"room_id"`
+}
+
+type CreateTicketRes struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int64  `json:"expires_in"`
+}
@@ -0,0 +1,15 @@
+package use_case
+
+import (
+	"context"
+
+	"chat-server/internal/domain/entity"
+)
+
+// BroadcastBus delivers room events to the local clients of every server instance.
+type BroadcastBus interface {
+	Publish(ctx context.Context, roomID entity.ID, ev *entity.Event) error
+	// Subscribe registers the handler for events of the room and returns a function cancelling the subscription.
+	Subscribe(ctx context.Context, roomID entity.ID, handler func(ev *entity.Event)) (func(), error)
+	Close() error
+}
@@ -5,13 +5,38 @@ import (
 )
 
 type MessageUseCase interface {
-	CreateMessage(req *entity.CreateMessageReq) (*entity.Message, error)
+	// CreateMessage returns the message sent before with the same client nonce instead of creating
+	// a new one, reporting whether the message has been created. If that message has been deleted,
+	// ErrMessageNonceDeleted is returned.
+	CreateMessage(req *entity.CreateMessageReq) (*entity.Message, bool, error)
+	// CreateMessageBulk creates the messages in one batch, assigning their IDs in the order of the requests.
+	CreateMessageBulk(reqs []*entity.CreateMessageReq) ([]entity.CreateMessageRes, error)
 	GetMessageByID(id entity.ID) (*entity.Message, error)
+	// EditMessageContent keeps the previous content of the message as a revision.
 	EditMessageContent(req *entity.EditMessageReq) (*entity.Message, error)
-	MarkReadMessageStatusByID(id entity.ID) error
+	GetMessageRevisions(id entity.ID) ([]entity.MessageRevision, error)
+	MarkReadMessageStatusByID(userID entity.ID, id entity.ID) (*entity.ReadCursor, error)
+	MarkDeliveredMessageStatus(userID entity.ID, roomID entity.ID, id entity.ID) (*entity.DeliveryCursor, error)
+	// MarkDeliveredMessageBulk marks the messages delivered without moving the delivery cursor of the user,
+	// which would mark the skipped messages too.
+	MarkDeliveredMessageBulk(userID entity.ID, roomID entity.ID, ids []entity.ID) error
+	// GetReceiptCounts counts the recipients the message has been delivered to and read by.
+	GetReceiptCounts(id entity.ID) (*entity.ReceiptCounts, error)
 	RemoveMessageByID(id entity.ID) error
 	RemoveMessageBulkByRoomID(roomID entity.ID) error
 
-	GetMessageBulkPaginate(req *entity.GetMessageBulkPaginateReq) ([]entity.Message, error)
+	GetMessageBulkPaginate(req *entity.GetMessageBulkPaginateReq) (*entity.MessagePage, error)
+	GetMessageBulkAfterID(roomID entity.ID, afterID entity.ID, limit uint) ([]entity.Message, error)
+	// GetThreadParent returns the message starting the thread a message of the room replying to id belongs to.
+	// A reply to a reply belongs to the thread of the first one, so threads are never nested.
+	GetThreadParent(roomID entity.ID, id entity.ID) (*entity.Message, error)
+	GetThread(req *entity.GetThreadReq) (*entity.Thread, error)
+	// AddReaction and RemoveReaction report whether the reaction has changed along with the resulting count of the emoji.
+	AddReaction(req *entity.ReactionReq) (*entity.ReactionChange, bool, error)
+	RemoveReaction(req *entity.ReactionReq) (*entity.ReactionChange, bool, error)
+	// PinMessage and UnpinMessage report whether the pin has changed.
+	PinMessage(req *entity.PinReq) (*entity.Pin, bool, error)
+	UnpinMessage(req *entity.PinReq) (*entity.Pin, bool, error)
+	GetPinBulkByRoomID(roomID entity.ID) ([]entity.Pin, error)
 	IsMessageOwner(userID entity.ID, messageID entity.ID) (bool, error)
 }
@@ -0,0 +1,21 @@
+package use_case
+
+import (
+	"context"
+
+	"chat-server/internal/domain/entity"
+)
+
+// PresenceUseCase tracks the connections of users. Methods changing the presence
+// return the new one and true if it differs from the previous presence.
+type PresenceUseCase interface {
+	Connect(ctx context.Context, userID entity.ID, connID string) (*entity.Presence, bool, error)
+	Disconnect(ctx context.Context, userID entity.ID, connID string) (*entity.Presence, bool, error)
+	Refresh(ctx context.Context, userID entity.ID, connID string) error
+	SetStatus(
+		ctx context.Context,
+		userID entity.ID,
+		status entity.PresenceStatus,
+	) (*entity.Presence, bool, error)
+	GetPresence(ctx context.Context, userID entity.ID) (*entity.Presence, error)
+}
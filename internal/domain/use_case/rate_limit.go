@@ -0,0 +1,16 @@
+package use_case
+
+import (
+	"context"
+
+	"chat-server/internal/domain/entity"
+)
+
+// RateLimitUseCase limits how often users send messages, across all their connections
+// to all server instances.
+type RateLimitUseCase interface {
+	// AllowMessage takes a token from the buckets of the user and of the user in the room
+	// and reports whether the message may be accepted. While the buckets are unavailable
+	// the message is either allowed or an error is returned, depending on the configuration.
+	AllowMessage(ctx context.Context, userID entity.ID, roomID entity.ID) (bool, error)
+}
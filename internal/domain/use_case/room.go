@@ -8,7 +8,12 @@ type RoomUseCase interface {
 	EditRoomInfo(req *entity.EditRoomReq) (*entity.EditRoomRes, error)
 	RemoveRoomByID(id entity.ID) error
 	RoomExists(id entity.ID) (bool, error)
+	// AllowsEphemeral reports whether the ephemeral messages are permitted in the room.
+	AllowsEphemeral(id entity.ID) (bool, error)
 	IsRoomOwner(roomID entity.ID, userID entity.ID) (bool, error)
 	HasRoomAccess(roomID entity.ID, userID entity.ID) (bool, error)
 	AddMemberToRoom(roomID entity.ID, userID entity.ID) (*entity.Member, error)
+	GetRoomIDsByUserID(userID entity.ID) ([]entity.ID, error)
+	// ShareRoom reports whether the users are members of at least one common room.
+	ShareRoom(userID entity.ID, otherUserID entity.ID) (bool, error)
 }
@@ -13,6 +13,14 @@ var (
 	ErrUserInvalid  = errors.New("user data is invalid or incomplete")
 	ErrRoomNotFound = errors.New("room not found")
 	ErrRoomInvalid  = errors.New("room data is invalid or incomplete")
+
+	ErrMessageNotFound  = errors.New("message not found")
+	ErrMessageDuplicate = errors.New("message with the same client nonce already exists")
+	// ErrMessageNonceDeleted is returned for a retry of a message deleted since it was sent,
+	// whose client nonce is still taken
+	ErrMessageNonceDeleted = errors.New("message with the same client nonce has been deleted")
+
+	ErrTicketNotFound = errors.New("ticket not found or already used")
 )
 
 type UserStorage interface {
@@ -39,23 +47,86 @@ type RoomStorage interface {
 }
 
 type MessageStorage interface {
+	// InsertMessage returns ErrMessageDuplicate if the sender has already sent a message with the same client nonce.
 	InsertMessage(message *entity.Message) (*entity.Message, error)
+	// InsertMessageBulk inserts the messages with one statement, assigning their IDs in the order of the slice.
+	// The ID of a message skipped as a duplicate by its client nonce is left zero.
+	InsertMessageBulk(messages []*entity.Message) error
 	SelectMessage(id entity.ID) (*entity.Message, error)
+	SelectMessageByClientNonce(senderID entity.ID, nonce string) (*entity.Message, error)
 	UpdateMessage(message *entity.Message) error
+	// UpdateMessageContent replaces the content of the active message, keeping the previous one as a revision.
+	UpdateMessageContent(message *entity.Message) error
+	// SelectRevisionBulkByMessageID selects the previous contents of the message, the oldest first.
+	SelectRevisionBulkByMessageID(messageID entity.ID) ([]entity.MessageRevision, error)
+	// MarkReadMessageBulk and MarkDeliveredMessageBulk update the messages in (fromID, upToID] only.
+	MarkReadMessageBulk(roomID entity.ID, fromID entity.ID, upToID entity.ID, readerID entity.ID) error
+	MarkDeliveredMessageBulk(roomID entity.ID, fromID entity.ID, upToID entity.ID, recipientID entity.ID) error
+	MarkDeliveredMessageBulkByID(roomID entity.ID, ids []entity.ID, recipientID entity.ID) error
+	SelectReceiptCounts(id entity.ID) (*entity.ReceiptCounts, error)
 	SoftDeleteMessageByID(id entity.ID) error
 	SoftDeleteMessageBulkByRoomID(roomID entity.ID) error
 
-	SelectMessageBulkPaginate(roomID entity.ID, perPage uint, page uint) ([]entity.Message, error)
-	SelectMessageBulkPaginateReverse(
+	// SelectMessageBulkBeforeID selects the active messages of the room with IDs less than beforeID, the newest first.
+	// The latest messages are selected if beforeID is zero.
+	SelectMessageBulkBeforeID(roomID entity.ID, beforeID entity.ID, limit uint) ([]entity.Message, error)
+	// SelectMessageBulkAfterID selects the active messages of the room with IDs greater than afterID in ID order.
+	SelectMessageBulkAfterID(roomID entity.ID, afterID entity.ID, limit uint) ([]entity.Message, error)
+	// SelectThreadReplyBulkAfterID selects the active replies of the thread with IDs greater than afterID in ID order.
+	SelectThreadReplyBulkAfterID(parentID entity.ID, afterID entity.ID, limit uint) ([]entity.Message, error)
+	// SelectThreadSummaryBulk summarizes the threads of the parent messages, skipping the ones without replies.
+	SelectThreadSummaryBulk(parentIDs []entity.ID) ([]entity.ThreadSummary, error)
+}
+
+type ReactionStorage interface {
+	// InsertReaction reports whether the reaction has been added, it is not if the user has already reacted with the emoji.
+	InsertReaction(messageID entity.ID, userID entity.ID, emoji entity.Emoji) (bool, error)
+	// DeleteReaction reports whether the reaction has been removed, it is not if the user has not reacted with the emoji.
+	DeleteReaction(messageID entity.ID, userID entity.ID, emoji entity.Emoji) (bool, error)
+	SelectReactionCount(messageID entity.ID, emoji entity.Emoji) (int, error)
+	// SelectReactionCountBulk counts the reactions of the messages per emoji, flagging the ones of the user.
+	SelectReactionCountBulk(messageIDs []entity.ID, userID entity.ID) ([]entity.MessageReactionCount, error)
+}
+
+type PinStorage interface {
+	// InsertPin reports whether the message has been pinned, it is not if it has been pinned before.
+	InsertPin(pin *entity.Pin) (*entity.Pin, bool, error)
+	// DeletePin reports whether the message has been unpinned, it is not if it has not been pinned.
+	DeletePin(roomID entity.ID, messageID entity.ID) (bool, error)
+	// SelectPinBulkByRoomID selects the pins of the active messages of the room in the order they were pinned.
+	SelectPinBulkByRoomID(roomID entity.ID) ([]entity.Pin, error)
+}
+
+type RateLimitStorage interface {
+	// TakeMessageToken takes a token from both buckets of the user if each of them has one
+	// and reports whether the token has been taken.
+	TakeMessageToken(
+		ctx context.Context,
+		userID entity.ID,
 		roomID entity.ID,
-		perPage uint,
-		page uint,
-	) ([]entity.Message, error)
+		userLimit entity.RateLimit,
+		roomLimit entity.RateLimit,
+	) (bool, error)
+}
+
+type ReadCursorStorage interface {
+	// UpsertReadCursor moves the cursor forward only and returns its resulting state
+	// along with the message ID it pointed to before, zero for a new cursor.
+	UpsertReadCursor(cursor *entity.ReadCursor) (*entity.ReadCursor, entity.ID, error)
+	SelectReadCursorBulkByRoomID(roomID entity.ID) ([]entity.ReadCursor, error)
+}
+
+type DeliveryCursorStorage interface {
+	// UpsertDeliveryCursor moves the cursor forward only and returns its resulting state
+	// along with the message ID it pointed to before, zero for a new cursor.
+	UpsertDeliveryCursor(cursor *entity.DeliveryCursor) (*entity.DeliveryCursor, entity.ID, error)
+	SelectDeliveryCursorBulkByRoomID(roomID entity.ID) ([]entity.DeliveryCursor, error)
 }
 
 type MemberStorage interface {
 	InsertMember(member *entity.Member) (*entity.Member, error)
 	SelectMemberBulkByRoomID(roomID entity.ID) ([]entity.Member, error)
+	SelectMemberBulkByUserID(userID entity.ID) ([]entity.Member, error)
 	UpdateMember(member *entity.Member) (*entity.Member, error)
 	DeleteMember(member *entity.Member) error
 }
@@ -69,3 +140,27 @@ type TokenStorage interface {
 	) error
 	InvalidRefreshTokenExists(ctx context.Context, refreshToken string) (bool, error)
 }
+
+type TicketStorage interface {
+	SaveTicket(ctx context.Context, ticket *entity.Ticket, ttl time.Duration) error
+	// TakeTicket gets and deletes the ticket at once, so it is redeemed only once.
+	TakeTicket(ctx context.Context, value string) (*entity.Ticket, error)
+}
+
+type PresenceStorage interface {
+	// AddConnection stores a live connection of the user and returns the number of live connections.
+	AddConnection(ctx context.Context, userID entity.ID, connID string, ttl time.Duration) (int64, error)
+	RefreshConnection(ctx context.Context, userID entity.ID, connID string, ttl time.Duration) error
+	// RemoveConnection removes the connection of the user and returns the number of live connections.
+	RemoveConnection(ctx context.Context, userID entity.ID, connID string) (int64, error)
+	CountConnections(ctx context.Context, userID entity.ID) (int64, error)
+
+	SetStatus(
+		ctx context.Context,
+		userID entity.ID,
+		status entity.PresenceStatus,
+		ttl time.Duration,
+	) (entity.PresenceStatus, error)
+	GetStatus(ctx context.Context, userID entity.ID) (entity.PresenceStatus, error)
+	DeleteStatus(ctx context.Context, userID entity.ID) error
+}
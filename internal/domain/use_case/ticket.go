@@ -0,0 +1,20 @@
+package use_case
+
+import (
+	"context"
+
+	"chat-server/internal/domain/entity"
+)
+
+// TicketUseCase issues the single-use tickets authenticating the opening of a chat WebSocket.
+type TicketUseCase interface {
+	IssueTicket(
+		ctx context.Context,
+		userID entity.ID,
+		username entity.NonEmptyString,
+		roomID entity.ID,
+	) (*entity.CreateTicketRes, error)
+	// RedeemTicket returns the ticket and invalidates it, it returns ErrTicketNotFound
+	// for an unknown, expired or already redeemed ticket.
+	RedeemTicket(ctx context.Context, value string) (*entity.Ticket, error)
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -20,21 +22,29 @@ const (
 )
 
 type AuthHandler struct {
-	userUseCase  use_case.UserUseCase
-	authUseCase  use_case.AuthUseCase
-	tokenUseCase use_case.TokenUseCase
+	userUseCase   use_case.UserUseCase
+	authUseCase   use_case.AuthUseCase
+	tokenUseCase  use_case.TokenUseCase
+	ticketUseCase use_case.TicketUseCase
+
+	// allowQueryAccessToken keeps accepting the access token in the query string of the chat WebSockets
+	allowQueryAccessToken bool
 }
 
 func NewAuthHandler(
 	uus use_case.UserUseCase,
 	aus use_case.AuthUseCase,
 	tus use_case.TokenUseCase,
+	tius use_case.TicketUseCase,
+	allowQueryAccessToken bool,
 	logger *logrus.Logger,
 ) *AuthHandler {
 	return &AuthHandler{
-		userUseCase:  uus,
-		authUseCase:  aus,
-		tokenUseCase: tus,
+		userUseCase:           uus,
+		authUseCase:           aus,
+		tokenUseCase:          tus,
+		ticketUseCase:         tius,
+		allowQueryAccessToken: allowQueryAccessToken,
 	}
 }
 
@@ -185,6 +195,92 @@ func (a *AuthHandler) UserIdentityByQueryParam(query string) gin.HandlerFunc {
 	}
 }
 
+// IssueTicket exchanges the access token for a single-use ticket opening a chat WebSocket.
+// The ticket of a room joins only that room, a ticket without a room opens /ws.
+func (a *AuthHandler) IssueTicket(c *gin.Context) {
+	var req entity.CreateTicketReq
+	// the body is optional for a ticket without a room
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("error binding JSON: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		log.Printf("error getting user ID: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username, err := getUsername(c)
+	if err != nil {
+		log.Printf("error getting username: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := a.ticketUseCase.IssueTicket(c, userID, username, req.RoomID)
+	if err != nil {
+		log.Printf("error issuing ticket: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("ticket issued: %d %d", userID, req.RoomID)
+	c.JSON(http.StatusCreated, res)
+}
+
+// UserIdentityByTicket sets the user of the ticket passed in the ticketQuery parameter.
+// The ticket must be issued for the room in the roomParam parameter, or without a room if roomParam is empty.
+// If access tokens in the query string are allowed, a request without a ticket is authenticated
+// by the tokenQuery parameter instead.
+func (a *AuthHandler) UserIdentityByTicket(ticketQuery, tokenQuery, roomParam string) gin.HandlerFunc {
+	identityByToken := a.UserIdentityByQueryParam(tokenQuery)
+	return func(c *gin.Context) {
+		value := c.Query(ticketQuery)
+		if value == "" {
+			if a.allowQueryAccessToken && c.Query(tokenQuery) != "" {
+				identityByToken(c)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"reason": "empty ticket"})
+			return
+		}
+
+		ticket, err := a.ticketUseCase.RedeemTicket(c, value)
+		if errors.Is(err, use_case.ErrTicketNotFound) {
+			log.Printf("error redeeming ticket: %v", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": use_case.ErrTicketNotFound.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("error redeeming ticket: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var roomID entity.ID
+		if roomParam != "" {
+			roomIDInt, err := strconv.Atoi(c.Param(roomParam))
+			if err != nil {
+				log.Printf("error converting room ID to int: %v", err)
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+				return
+			}
+			roomID = entity.ID(roomIDInt)
+		}
+		if ticket.RoomID != roomID {
+			log.Printf("ticket of room %d used for room %d", ticket.RoomID, roomID)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "ticket is not valid for the room"})
+			return
+		}
+
+		c.Set(userCtx, ticket.UserID)
+		c.Set(usernameCtx, string(ticket.Username))
+		log.Printf("user identity set by ticket: %d %s", ticket.UserID, ticket.Username)
+	}
+}
+
 func (a *AuthHandler) UserPermissionMiddlewareByParam(paramKey string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userIDInt, err := strconv.Atoi(c.Param(paramKey))
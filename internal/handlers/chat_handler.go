@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -16,21 +20,132 @@ import (
 	"chat-server/internal/service"
 )
 
+const (
+	// typingTimeout is how long a typing state lives unless the client refreshes it
+	typingTimeout = 5 * time.Second
+	// typingThrottle is the minimal interval between typing events accepted from one client
+	typingThrottle = 500 * time.Millisecond
+	// replayBatchSize is the number of missed messages selected at once on a reconnect
+	replayBatchSize = 100
+	// replayLimit is the maximal number of missed messages replayed on a reconnect,
+	// a client which has missed more fetches the rest through REST
+	replayLimit = 1000
+)
+
+// hubEntry counts the references to the hub of a room, so the hub is stopped
+// only when the last client leaves.
+type hubEntry struct {
+	hub         *service.Hub
+	refs        int
+	unsubscribe func()
+	ephemeral   *ephemeralPermission
+	// ready is closed once the hub is subscribed to the bus, err is set if the subscription failed
+	ready chan struct{}
+	err   error
+	// stopped is set when the last reference is dropped and closed once the hub is stopped
+	stopped chan struct{}
+}
+
+// ephemeralPermission caches whether the ephemeral messages are permitted in the room of a hub.
+// It is reset by the room.updated event, so it follows the updates made through any server instance.
+type ephemeralPermission struct {
+	mu      sync.Mutex
+	known   bool
+	allowed bool
+	// version counts the resets, so a permission selected before a reset is not cached
+	version uint64
+}
+
+func (p *ephemeralPermission) get(load func() (bool, error)) (bool, error) {
+	p.mu.Lock()
+	if p.known {
+		allowed := p.allowed
+		p.mu.Unlock()
+		return allowed, nil
+	}
+	version := p.version
+	p.mu.Unlock()
+
+	allowed, err := load()
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.version == version {
+		p.known = true
+		p.allowed = allowed
+	}
+	return allowed, nil
+}
+
+func (p *ephemeralPermission) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.known = false
+	p.version++
+}
+
 type ChatHandler struct {
-	messageUseCase use_case.MessageUseCase
+	messageUseCase  use_case.MessageUseCase
+	roomUseCase     use_case.RoomUseCase
+	presenceUseCase use_case.PresenceUseCase
+	presenceRefresh time.Duration
+	bus             use_case.BroadcastBus
+	persister       *service.MessagePersister
+
+	rateLimitUseCase use_case.RateLimitUseCase
+	frameLimit       entity.RateLimit
+	maxViolations    int
 
-	chatsMu sync.Mutex
-	chats   map[entity.ID]*service.Chat
+	hubsMu sync.Mutex
+	hubs   map[entity.ID]*hubEntry
 
-	messageBuffSize   int
-	broadcastBuffSize int
+	// clients are the connected clients, closing is set once the shutdown starts
+	clientsMu sync.Mutex
+	clients   map[*service.Client]struct{}
+	sessions  sync.WaitGroup
+	closing   atomic.Bool
+
+	typing     *service.TypingTracker
+	deliveries *service.DeliveryTracker
+
+	cfg *service.ChatConfig
 }
 
-func NewChatHandler(messageUseCase use_case.MessageUseCase, logger *logrus.Logger) *ChatHandler {
-	return &ChatHandler{
-		messageUseCase: messageUseCase,
-		chats:          make(map[entity.ID]*service.Chat),
+func NewChatHandler(
+	messageUseCase use_case.MessageUseCase,
+	roomUseCase use_case.RoomUseCase,
+	presenceUseCase use_case.PresenceUseCase,
+	presenceRefresh time.Duration,
+	bus use_case.BroadcastBus,
+	persisterConfig *service.PersisterConfig,
+	rateLimitUseCase use_case.RateLimitUseCase,
+	frameLimit entity.RateLimit,
+	maxViolations int,
+	cfg *service.ChatConfig,
+	logger *logrus.Logger,
+) *ChatHandler {
+	ch := &ChatHandler{
+		messageUseCase:   messageUseCase,
+		roomUseCase:      roomUseCase,
+		presenceUseCase:  presenceUseCase,
+		presenceRefresh:  presenceRefresh,
+		bus:              bus,
+		rateLimitUseCase: rateLimitUseCase,
+		frameLimit:       frameLimit,
+		maxViolations:    maxViolations,
+		hubs:             make(map[entity.ID]*hubEntry),
+		clients:          make(map[*service.Client]struct{}),
+		cfg:              cfg,
 	}
+	ch.typing = service.NewTypingTracker(typingTimeout, ch.sendTypingStopped)
+	ch.persister = service.NewMessagePersister(persisterConfig, messageUseCase)
+	ch.persister.Start()
+	ch.deliveries = service.NewDeliveryTracker(cfg.DeliveryFlushInterval, ch.markDelivered)
+	ch.deliveries.Start()
+	return ch
 }
 
 func (ch *ChatHandler) JoinRoom(c *gin.Context) {
@@ -41,6 +156,18 @@ func (ch *ChatHandler) JoinRoom(c *gin.Context) {
 		return
 	}
 
+	since, err := getSinceParam(c)
+	if err != nil {
+		log.Printf("error getting since param: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ch.closing.Load() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": errShuttingDown.Error()})
+		return
+	}
+
 	conn, err := ch.acceptWebSocket(c)
 	if err != nil {
 		log.Printf("error accepting WebSocket connection: %v", err)
@@ -48,15 +175,154 @@ func (ch *ChatHandler) JoinRoom(c *gin.Context) {
 	}
 	defer conn.Close(websocket.StatusInternalError, "")
 
-	cl := ch.createClient(conn, roomID, userID)
-	defer ch.deleteClient(roomID, cl)
+	cl := service.NewClient(conn, ch.cfg, roomID, userID)
+	if !ch.addClient(cl) {
+		conn.Close(websocket.StatusGoingAway, errShuttingDown.Error())
+		return
+	}
+	defer ch.removeClient(cl)
+	defer cl.Close()
+	defer ch.leaveAllHubs(cl)
+
+	// the missed messages are replayed on joining, so the client must already be written to
+	go cl.WriteMessage(ch)
 
-	go cl.WriteMessage()
-	go ch.startBroadcastManager(roomID)
+	replay, err := ch.joinHub(cl, roomID, since)
+	if err != nil {
+		log.Printf("error joining room hub: %v", err)
+		return
+	}
+	if replay != nil {
+		go ch.replayMessages(cl, replay, since)
+	}
 
 	log.Printf("user joined room: %d %d", userID, roomID)
 
-	cl.ReadMessage(ch.chats[roomID].Broadcast)
+	ch.serveClient(cl)
+}
+
+// serveClient runs the connection of the client until it is closed.
+func (ch *ChatHandler) serveClient(cl *service.Client) {
+	ch.connectPresence(cl)
+	defer ch.disconnectPresence(cl)
+	presenceDone := make(chan struct{})
+	defer close(presenceDone)
+	go ch.refreshPresence(cl, presenceDone)
+
+	go cl.Heartbeat()
+
+	cl.ReadMessage(ch)
+}
+
+// HandleEvent dispatches an event received from the client by its type.
+func (ch *ChatHandler) HandleEvent(cl *service.Client, ev *entity.InboundEvent) error {
+	switch ev.Type {
+	case entity.EventMessageNew, entity.EventMessageEphemeral:
+		// messages are limited per user and room by allowMessage
+	default:
+		if err := ch.allowFrame(cl); err != nil {
+			return err
+		}
+	}
+
+	switch ev.Type {
+	case entity.EventMessageNew:
+		var payload entity.NewMessagePayload
+		if err := ev.DecodePayload(&payload); err != nil {
+			return err
+		}
+		hub, err := ch.eventHub(cl, ev)
+		if err != nil {
+			return err
+		}
+		parentID, err := ch.threadParentID(hub.RoomID, payload.ParentID)
+		if err != nil {
+			return entity.NewProtocolError(entity.ErrCodeInvalidPayload, "%v", err)
+		}
+		if err := ch.allowMessage(cl, hub.RoomID); err != nil {
+			return err
+		}
+		msg := &entity.Message{
+			RoomID:      hub.RoomID,
+			SenderID:    cl.UserID,
+			Content:     payload.Content,
+			ClientNonce: payload.Nonce,
+			ParentID:    parentID,
+		}
+		if !hub.Submit(msg) {
+			return fmt.Errorf("ChatHandler.HandleEvent: hub of room %d is stopped", hub.RoomID)
+		}
+		return nil
+	case entity.EventMessageEphemeral:
+		var payload entity.EphemeralMessagePayload
+		if err := ev.DecodePayload(&payload); err != nil {
+			return err
+		}
+		hub, err := ch.eventHub(cl, ev)
+		if err != nil {
+			return err
+		}
+		return ch.sendEphemeralMessage(cl, hub.RoomID, &payload)
+	case entity.EventTypingStarted:
+		hub, err := ch.eventHub(cl, ev)
+		if err != nil {
+			return err
+		}
+		// typing events are ephemeral: they are fanned out but never persisted
+		if !cl.AllowTyping(typingThrottle) {
+			return nil
+		}
+		if ch.typing.Start(hub.RoomID, cl.UserID, cl.ID) {
+			payload := &entity.TypingPayload{RoomID: hub.RoomID, UserID: cl.UserID}
+			ch.sendEventForOtherClientsInRoom(
+				hub.RoomID,
+				cl.UserID,
+				entity.NewEvent(entity.EventTypingStarted, payload),
+			)
+		}
+		return nil
+	case entity.EventTypingStopped:
+		hub, err := ch.eventHub(cl, ev)
+		if err != nil {
+			return err
+		}
+		// stops are not throttled: they are fanned out only after an accepted start
+		if ch.typing.Stop(hub.RoomID, cl.UserID, cl.ID) {
+			ch.sendTypingStopped(hub.RoomID, cl.UserID)
+		}
+		return nil
+	case entity.EventMessageRead:
+		hub, err := ch.eventHub(cl, ev)
+		if err != nil {
+			return err
+		}
+		var payload entity.ReadUpToPayload
+		if err := ev.DecodePayload(&payload); err != nil {
+			return err
+		}
+		msg, err := ch.messageUseCase.GetMessageByID(payload.MessageID)
+		if err != nil || msg.RoomID != hub.RoomID {
+			return entity.NewProtocolError(
+				entity.ErrCodeInvalidPayload,
+				"message %d not found in room %d",
+				payload.MessageID,
+				hub.RoomID,
+			)
+		}
+		return ch.markRead(cl.UserID, msg.ID)
+	case entity.EventPresenceUpdate:
+		var payload entity.PresenceUpdatePayload
+		if err := ev.DecodePayload(&payload); err != nil {
+			return err
+		}
+		return ch.updatePresence(cl, payload.Status)
+	case entity.EventRoomSubscribe:
+		return ch.subscribeRoom(cl, ev)
+	case entity.EventRoomUnsubscribe:
+		return ch.unsubscribeRoom(cl, ev)
+	default:
+		return entity.NewProtocolError(entity.ErrCodeUnknownType, "unknown event type %q", ev.Type)
+	}
 }
 
 func (ch *ChatHandler) getRoomIDAndUserIDParams(c *gin.Context) (entity.ID, entity.ID, error) {
@@ -73,24 +339,34 @@ func (ch *ChatHandler) getRoomIDAndUserIDParams(c *gin.Context) (entity.ID, enti
 	return entity.ID(roomIDInt), entity.ID(userIDInt), nil
 }
 
+// getSinceParam returns the ID of the last message seen by a reconnecting client, zero if it is not passed.
+func getSinceParam(c *gin.Context) (entity.ID, error) {
+	sinceStr := c.Query("since")
+	if sinceStr == "" {
+		return 0, nil
+	}
+	since, err := strconv.ParseUint(sinceStr, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("error converting since to int: %w", err)
+	}
+	return entity.ID(since), nil
+}
+
 func (ch *ChatHandler) acceptWebSocket(c *gin.Context) (*websocket.Conn, error) {
-	conn, err := websocket.Accept(c.Writer, c.Request, nil)
+	conn, err := websocket.Accept(c.Writer, c.Request, &websocket.AcceptOptions{
+		Subprotocols:         service.Subprotocols(),
+		OriginPatterns:       ch.cfg.OriginPatterns,
+		CompressionMode:      ch.cfg.CompressionMode,
+		CompressionThreshold: ch.cfg.CompressionThreshold,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error accepting WebSocket connection: %w", err)
 	}
+	// an oversized frame closes the connection with StatusMessageTooBig before it is handled
+	conn.SetReadLimit(ch.cfg.MaxMessageSize)
 	return conn, nil
 }
 
-func (ch *ChatHandler) createClient(
-	conn *websocket.Conn,
-	roomID entity.ID,
-	userID entity.ID,
-) *service.Client {
-	cl := service.NewClient(conn, ch.messageBuffSize, roomID, userID)
-	ch.addClient(roomID, cl)
-	return cl
-}
-
 func (ch *ChatHandler) EditMessage(c *gin.Context) {
 	var req entity.EditMessageReq
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -124,6 +400,58 @@ func (ch *ChatHandler) EditMessage(c *gin.Context) {
 	c.JSON(http.StatusOK, message)
 }
 
+// GetMessageRevisions returns the previous contents of the message, the oldest first.
+func (ch *ChatHandler) GetMessageRevisions(c *gin.Context) {
+	idInt, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Printf("error converting message ID to int: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+	id := entity.ID(idInt)
+
+	revisions, err := ch.messageUseCase.GetMessageRevisions(id)
+	if err != nil {
+		log.Printf("error getting message revisions: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if revisions == nil {
+		revisions = []entity.MessageRevision{}
+	}
+
+	log.Printf("message revisions retrieved: %d", id)
+	c.JSON(http.StatusOK, revisions)
+}
+
+func (ch *ChatHandler) MarkMessageRead(c *gin.Context) {
+	idInt, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Printf("error converting message ID to int: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+	id := entity.ID(idInt)
+
+	userID, err := getUserID(c)
+	if err != nil {
+		log.Printf("error getting user ID: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cursor, err := ch.messageUseCase.MarkReadMessageStatusByID(userID, id)
+	if err != nil {
+		log.Printf("error marking message read: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ch.sendReadReceipt(cursor, id)
+
+	log.Printf("message read: %d %d", userID, id)
+	c.JSON(http.StatusOK, cursor)
+}
+
 func (ch *ChatHandler) DeleteMessage(c *gin.Context) {
 	idInt, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -162,10 +490,12 @@ func (ch *ChatHandler) DeleteAllMessageFromRoom(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// GetMessageBulkPaginate returns a page of the room history, the newest messages first.
+// The page is selected by the limit and the before or after cursor of the query.
 func (ch *ChatHandler) GetMessageBulkPaginate(c *gin.Context) {
 	var req entity.GetMessageBulkPaginateReq
-	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("error binding JSON: %v", err)
+	if err := c.ShouldBindQuery(&req); err != nil {
+		log.Printf("error binding query: %v", err)
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -176,6 +506,7 @@ func (ch *ChatHandler) GetMessageBulkPaginate(c *gin.Context) {
 		return
 	}
 	req.RoomID = entity.ID(roomID)
+	req.UserID, _ = getUserID(c)
 
 	if err := req.Validate(); err != nil {
 		log.Printf("error validating request: %v", err)
@@ -183,14 +514,86 @@ func (ch *ChatHandler) GetMessageBulkPaginate(c *gin.Context) {
 		return
 	}
 
-	messages, err := ch.messageUseCase.GetMessageBulkPaginate(&req)
+	page, err := ch.messageUseCase.GetMessageBulkPaginate(&req)
 	if err != nil {
 		log.Printf("error getting messages paginate: %v", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	if req.UserID != 0 {
+		ch.markPageDelivered(req.RoomID, req.UserID, page)
+	}
 	log.Printf("messages paginate retrieved: %d", roomID)
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, page)
+}
+
+// markPageDelivered delivers the fetched messages to the user like the ones written to its connections.
+// The delivery cursor is moved only by a page with the newest messages, since a page in the middle
+// of the history leaves the messages between it and the newest ones unseen. Only the messages
+// of such a page are marked delivered.
+func (ch *ChatHandler) markPageDelivered(roomID entity.ID, userID entity.ID, page *entity.MessagePage) {
+	var ids []entity.ID
+	var lastID entity.ID
+	for _, message := range page.Messages {
+		if message.SenderID == userID {
+			continue
+		}
+		ids = append(ids, message.ID)
+		if message.ID > lastID {
+			lastID = message.ID
+		}
+	}
+	if lastID == 0 {
+		return
+	}
+
+	if page.PrevCursor == "" {
+		ch.deliveries.Delivered(roomID, userID, lastID)
+		return
+	}
+	if err := ch.messageUseCase.MarkDeliveredMessageBulk(userID, roomID, ids); err != nil {
+		log.Printf("error marking messages delivered: %v", err)
+	}
+}
+
+// GetThread returns the parent message with the reply count and the last reply time of its thread,
+// followed by a page of the replies, oldest first. The limit query parameter sets the page size and
+// the after query parameter continues with the replies following the cursor; without it the first page is returned.
+func (ch *ChatHandler) GetThread(c *gin.Context) {
+	var req entity.GetThreadReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		log.Printf("error binding query: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Printf("error converting message ID to int: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+	req.ParentID = entity.ID(messageID)
+	req.UserID, _ = getUserID(c)
+
+	if err := req.Validate(); err != nil {
+		log.Printf("error validating request: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	thread, err := ch.messageUseCase.GetThread(&req)
+	if errors.Is(err, use_case.ErrMessageNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("error getting thread: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("thread retrieved: %d", thread.Parent.ID)
+	c.JSON(http.StatusOK, thread)
 }
 
 func (ch *ChatHandler) MessagePermissionMiddlewareByParam(paramKey string) gin.HandlerFunc {
@@ -228,6 +631,98 @@ func (ch *ChatHandler) MessagePermissionMiddlewareByParam(paramKey string) gin.H
 	}
 }
 
+// MessageAuditMiddlewareByParam checks that the user is the sender of the message or the owner of its room.
+func (ch *ChatHandler) MessageAuditMiddlewareByParam(paramKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		messageIDInt, err := strconv.Atoi(c.Param(paramKey))
+		if err != nil {
+			log.Printf("error converting message ID to int: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+			return
+		}
+		messageID := entity.ID(messageIDInt)
+
+		userID, err := getUserID(c)
+		if err != nil {
+			log.Printf("error getting user ID: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		msg, err := ch.messageUseCase.GetMessageByID(messageID)
+		if err != nil {
+			log.Printf("error getting message by ID: %v", err)
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+		if msg.SenderID == userID {
+			c.Next()
+			return
+		}
+
+		isOwner, err := ch.roomUseCase.IsRoomOwner(msg.RoomID, userID)
+		if err != nil {
+			log.Printf("error checking if user is room owner: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !isOwner {
+			log.Printf("access denied to message: %d %d", userID, messageID)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// MessageAccessMiddlewareByParam checks that the user has access to the room of the message.
+func (ch *ChatHandler) MessageAccessMiddlewareByParam(paramKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		messageIDInt, err := strconv.Atoi(c.Param(paramKey))
+		if err != nil {
+			log.Printf("error converting message ID to int: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+			return
+		}
+		messageID := entity.ID(messageIDInt)
+
+		userID, err := getUserID(c)
+		if err != nil {
+			log.Printf("error getting user ID: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		msg, err := ch.messageUseCase.GetMessageByID(messageID)
+		if err != nil {
+			log.Printf("error getting message by ID: %v", err)
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+
+		hasAccess, err := ch.roomUseCase.HasRoomAccess(msg.RoomID, userID)
+		if err != nil {
+			log.Printf("error checking if user has access to room: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !hasAccess {
+			log.Printf("access denied to message: %d %d", userID, messageID)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// broadcastEventCtx holds the event built for the room by a handler behind BroadcastMessageUpdateMiddleware.
+// A nil event means the handler has changed nothing.
+const broadcastEventCtx = "broadcastEvent"
+
+// BroadcastMessageUpdateMiddleware publishes the change of the message to its room once the handler has succeeded.
+// The event is the one built by the handler, otherwise it is derived from the request method.
 func (ch *ChatHandler) BroadcastMessageUpdateMiddleware(c *gin.Context) {
 	messageIDInt, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -237,71 +732,421 @@ func (ch *ChatHandler) BroadcastMessageUpdateMiddleware(c *gin.Context) {
 	}
 	messageID := entity.ID(messageIDInt)
 
+	// the message is fetched beforehand because a deleted one can no longer be selected
+	msg, err := ch.messageUseCase.GetMessageByID(messageID)
+	if errors.Is(err, use_case.ErrMessageNotFound) {
+		log.Printf("error getting message by ID: %v", err)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("error getting message by ID: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.Next()
 	if c.IsAborted() {
 		return
 	}
 
-	msg, err := ch.messageUseCase.GetMessageByID(messageID)
+	if evAny, ok := c.Get(broadcastEventCtx); ok {
+		if ev, ok := evAny.(*entity.Event); ok && ev != nil {
+			ch.sendEventForAllClientInRoom(msg.RoomID, ev)
+		}
+		return
+	}
+
+	if c.Request.Method == http.MethodDelete {
+		payload := &entity.MessageDeletedPayload{ID: msg.ID, RoomID: msg.RoomID}
+		ch.sendEventForAllClientInRoom(msg.RoomID, entity.NewEvent(entity.EventMessageDeleted, payload))
+		return
+	}
+
+	msg, err = ch.messageUseCase.GetMessageByID(messageID)
 	if err != nil {
 		log.Printf("error getting message by ID: %v", err)
 		return
 	}
-	ch.sendMessageForAllClientInRoom(msg)
+	ch.sendEventForAllClientInRoom(msg.RoomID, entity.NewEvent(entity.EventMessageEdited, msg))
+}
+
+// allowMessage applies the rate limit to a message of the client. A client that keeps sending
+// messages over the limit is disconnected.
+func (ch *ChatHandler) allowMessage(cl *service.Client, roomID entity.ID) error {
+	allowed, err := ch.rateLimitUseCase.AllowMessage(context.Background(), cl.UserID, roomID)
+	if err != nil {
+		log.Printf("error checking rate limit: %v", err)
+		return fmt.Errorf("ChatHandler.allowMessage: %w", err)
+	}
+	if !allowed {
+		cl.AddViolation(ch.maxViolations)
+		return entity.NewProtocolError(entity.ErrCodeRateLimited, "rate limit exceeded in room %d", roomID)
+	}
+	cl.ResetViolations()
+	return nil
+}
+
+// allowFrame applies the per-connection limit to a frame of the client other than a message.
+// The rejected frames count as violations like the rejected messages, the accepted ones do not reset them.
+func (ch *ChatHandler) allowFrame(cl *service.Client) error {
+	if !cl.AllowFrame(ch.frameLimit) {
+		cl.AddViolation(ch.maxViolations)
+		return entity.NewProtocolError(entity.ErrCodeRateLimited, "rate limit exceeded")
+	}
+	return nil
+}
+
+// sendEphemeralMessage fans the message out to the other clients of the room without persisting it.
+// It is rate limited like a persisted message.
+func (ch *ChatHandler) sendEphemeralMessage(
+	cl *service.Client,
+	roomID entity.ID,
+	payload *entity.EphemeralMessagePayload,
+) error {
+	allowed, err := ch.allowsEphemeral(roomID)
+	if err != nil {
+		return fmt.Errorf("ChatHandler.sendEphemeralMessage: %w", err)
+	}
+	if !allowed {
+		return entity.NewProtocolError(
+			entity.ErrCodeForbidden,
+			"ephemeral messages are not allowed in room %d",
+			roomID,
+		)
+	}
+	if err := ch.allowMessage(cl, roomID); err != nil {
+		return err
+	}
+
+	msg := &entity.EphemeralMessage{
+		RoomID:   roomID,
+		SenderID: cl.UserID,
+		Kind:     payload.Kind,
+		Content:  payload.Content,
+		SentAt:   time.Now(),
+	}
+	ch.sendEventForOtherClientsInRoom(roomID, cl.UserID, entity.NewEvent(entity.EventMessageEphemeral, msg))
+	return nil
+}
+
+// allowsEphemeral reports whether the ephemeral messages are permitted in the room,
+// which is cached by the hub of the room until the room is updated.
+func (ch *ChatHandler) allowsEphemeral(roomID entity.ID) (bool, error) {
+	load := func() (bool, error) {
+		return ch.roomUseCase.AllowsEphemeral(roomID)
+	}
+
+	ch.hubsMu.Lock()
+	entry, ok := ch.hubs[roomID]
+	ch.hubsMu.Unlock()
+	if !ok {
+		return load()
+	}
+	return entry.ephemeral.get(load)
 }
 
-// startBroadcastManager starts the broadcast manager for the chat with the specified ID (if it is not already started).
-func (ch *ChatHandler) startBroadcastManager(roomID entity.ID) {
-	if chat, ok := ch.chats[roomID]; ok && !chat.BroadcastManagerStatus {
-		ch.broadcastManager(chat.Broadcast)
+// processMessage queues the message received by the hub for the batched insert. The messages of the room
+// are processed by its hub one by one, so they are persisted and published in the order they were received.
+func (ch *ChatHandler) processMessage(msg *entity.Message) {
+	req := entity.NewCreateMessageReq(msg)
+	if !ch.persister.Persist(req, ch.publishMessage) {
+		log.Printf("error creating message: persister is stopped, room %d", msg.RoomID)
 	}
 }
 
-// broadcastManager handles messages from the broadcast channel and sends them to all clients in the chat.
-func (ch *ChatHandler) broadcastManager(broadcast chan *entity.Message) {
+// publishMessage publishes the persisted message to the room.
+// A retried message is already known to the room, so it is sent back to its sender only.
+func (ch *ChatHandler) publishMessage(message *entity.Message, created bool, err error) {
+	if err != nil {
+		log.Printf("error creating message: %v", err)
+		return
+	}
+	ev := newMessageEvent(message)
+	if !created {
+		ev.ToUserID = message.SenderID
+		ch.sendEventForAllClientInRoom(message.RoomID, ev)
+		log.Printf("message retry answered: %d", message.ID)
+		return
+	}
+	ch.sendEventForAllClientInRoom(message.RoomID, ev)
+	log.Printf("message broadcasted: %d", message.ID)
+}
+
+// newMessageEvent builds the event carrying the persisted message. A reply in a thread is sent
+// as its own event type, so clients can show it inline or next to the room.
+func newMessageEvent(message *entity.Message) *entity.Event {
+	eventType := entity.EventMessageNew
+	if message.ParentID != 0 {
+		eventType = entity.EventThreadReply
+	}
+	ev := entity.NewEvent(eventType, message)
+	ev.Seq = message.ID
+	ev.SenderID = message.SenderID
+	return ev
+}
+
+// threadParentID returns the message starting the thread of a reply sent to the room,
+// or zero for a message which does not reply in a thread.
+func (ch *ChatHandler) threadParentID(roomID entity.ID, parentID entity.ID) (entity.ID, error) {
+	if parentID == 0 {
+		return 0, nil
+	}
+	parent, err := ch.messageUseCase.GetThreadParent(roomID, parentID)
+	if err != nil {
+		log.Printf("error getting thread parent: %v", err)
+		return 0, fmt.Errorf("parent message %d not found in room %d", parentID, roomID)
+	}
+	return parent.ID, nil
+}
+
+// sendEventForAllClientInRoom publishes the event to the broadcast bus, so it reaches
+// the clients of the room connected to any server instance.
+func (ch *ChatHandler) sendEventForAllClientInRoom(roomID entity.ID, ev *entity.Event) {
+	// the same event may be sent to several rooms, so a copy of it is tagged with the room
+	tagged := *ev
+	tagged.RoomID = roomID
+	if err := ch.bus.Publish(context.Background(), roomID, &tagged); err != nil {
+		log.Printf("error publishing event: %v", err)
+	}
+}
+
+// sendEventForOtherClientsInRoom sends the event to all clients in the room except the ones of the specified user.
+func (ch *ChatHandler) sendEventForOtherClientsInRoom(
+	roomID entity.ID,
+	exceptUserID entity.ID,
+	ev *entity.Event,
+) {
+	ev.ExceptUserID = exceptUserID
+	ch.sendEventForAllClientInRoom(roomID, ev)
+}
+
+func (ch *ChatHandler) markRead(userID entity.ID, messageID entity.ID) error {
+	cursor, err := ch.messageUseCase.MarkReadMessageStatusByID(userID, messageID)
+	if err != nil {
+		return fmt.Errorf("ChatHandler.markRead: %w", err)
+	}
+	ch.sendReadReceipt(cursor, messageID)
+	return nil
+}
+
+// sendReadReceipt notifies the room about the read cursor if it has been moved up to the message.
+func (ch *ChatHandler) sendReadReceipt(cursor *entity.ReadCursor, messageID entity.ID) {
+	if cursor.LastReadMessageID != messageID {
+		return
+	}
+	counts, err := ch.messageUseCase.GetReceiptCounts(messageID)
+	if err != nil {
+		log.Printf("error getting receipt counts: %v", err)
+		return
+	}
+	receipt := &entity.ReadReceipt{ReadCursor: *cursor, ReceiptCounts: *counts}
+	ch.sendEventForAllClientInRoom(cursor.RoomID, entity.NewEvent(entity.EventMessageRead, receipt))
+}
+
+// Delivered records the delivery of a message written to a client of a recipient.
+// The deliveries are coalesced and the delivery cursors are moved once per interval.
+func (ch *ChatHandler) Delivered(cl *service.Client, ev *entity.Event) {
+	if ev.Type != entity.EventMessageNew && ev.Type != entity.EventThreadReply {
+		return
+	}
+	if ev.Seq == 0 || ev.SenderID == cl.UserID {
+		return
+	}
+	ch.deliveries.Delivered(ev.RoomID, cl.UserID, ev.Seq)
+}
+
+func (ch *ChatHandler) markDelivered(roomID entity.ID, userID entity.ID, messageID entity.ID) {
+	cursor, err := ch.messageUseCase.MarkDeliveredMessageStatus(userID, roomID, messageID)
+	if err != nil {
+		log.Printf("error marking message delivered: %v", err)
+		return
+	}
+	ch.sendDeliveryReceipt(cursor, messageID)
+}
+
+// sendDeliveryReceipt notifies the room about the delivery cursor if it has been moved up to the message.
+func (ch *ChatHandler) sendDeliveryReceipt(cursor *entity.DeliveryCursor, messageID entity.ID) {
+	if cursor.LastDeliveredMessageID != messageID {
+		return
+	}
+	counts, err := ch.messageUseCase.GetReceiptCounts(messageID)
+	if err != nil {
+		log.Printf("error getting receipt counts: %v", err)
+		return
+	}
+	receipt := &entity.DeliveryReceipt{DeliveryCursor: *cursor, ReceiptCounts: *counts}
+	ch.sendEventForAllClientInRoom(cursor.RoomID, entity.NewEvent(entity.EventMessageDelivered, receipt))
+}
+
+func (ch *ChatHandler) sendTypingStopped(roomID entity.ID, userID entity.ID) {
+	payload := &entity.TypingPayload{RoomID: roomID, UserID: userID}
+	ch.sendEventForOtherClientsInRoom(roomID, userID, entity.NewEvent(entity.EventTypingStopped, payload))
+}
+
+// joinHub registers the client in the hub of the room. If the hub does not exist, it is started
+// and subscribed to the events of the room on the broadcast bus. If since is not zero, the live events
+// of the room are held until the returned replay of the messages after since is run by replayMessages.
+func (ch *ChatHandler) joinHub(cl *service.Client, roomID entity.ID, since entity.ID) (*service.Replay, error) {
+	hub, err := ch.acquireHub(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("ChatHandler.joinHub: %w", err)
+	}
+	if since == 0 {
+		hub.Register(cl)
+		cl.AddHub(hub)
+		return nil, nil
+	}
+
+	// live events are held from the registration on, so a message persisted during the replay
+	// is either replayed or delivered after it, and one both replayed and held is dropped once
+	replay := cl.Hold(roomID)
+	hub.Register(cl)
+	cl.AddHub(hub)
+	return replay, nil
+}
+
+// replayMessages sends the messages of the room after since to the client and releases the live events
+// held meanwhile. At most replayLimit messages are replayed. If there are more or they cannot be selected,
+// the replay ends with a replay.truncated event pointing to the rest of the history.
+func (ch *ChatHandler) replayMessages(cl *service.Client, replay *service.Replay, since entity.ID) {
+	defer cl.Release(replay)
+
+	roomID := replay.RoomID()
+	afterID := since
+	count := 0
 	for {
-		select {
-		case msg := <-broadcast:
-			req := entity.NewCreateMessageReq(msg)
-			message, err := ch.messageUseCase.CreateMessage(req)
-			if err != nil {
-				log.Printf("error creating message: %v", err)
-				continue
+		messages, err := ch.messageUseCase.GetMessageBulkAfterID(roomID, afterID, replayBatchSize)
+		if err != nil {
+			log.Printf("error replaying messages: %v", err)
+			ch.sendReplayTruncated(cl, replay, afterID)
+			return
+		}
+		for i := range messages {
+			if count == replayLimit {
+				ch.sendReplayTruncated(cl, replay, afterID)
+				return
+			}
+			msg := &messages[i]
+			ev := newMessageEvent(msg)
+			ev.RoomID = roomID
+			if !cl.SendReplayed(replay, ev) {
+				return
 			}
-			ch.sendMessageForAllClientInRoom(message)
-			log.Printf("message broadcasted: %d", message.ID)
+			afterID = msg.ID
+			count++
+		}
+		if len(messages) < replayBatchSize {
+			return
 		}
 	}
 }
 
-func (ch *ChatHandler) sendMessageForAllClientInRoom(msg *entity.Message) {
-	if chat, ok := ch.chats[msg.RoomID]; ok {
-		for cl := range chat.Clients {
-			cl.Message <- msg
-		}
+func (ch *ChatHandler) sendReplayTruncated(cl *service.Client, replay *service.Replay, afterID entity.ID) {
+	ev := entity.NewEvent(entity.EventReplayTruncated, &entity.ReplayTruncatedPayload{
+		After: entity.NewMessageCursor(afterID),
+	})
+	ev.RoomID = replay.RoomID()
+	cl.SendReplayed(replay, ev)
+}
+
+// leaveHub removes the client from the hub. The hub of a room without clients is stopped.
+func (ch *ChatHandler) leaveHub(hub *service.Hub, cl *service.Client) {
+	cl.RemoveHub(hub)
+	hub.Unregister(cl)
+	ch.releaseHub(hub)
+
+	if ch.typing.Stop(hub.RoomID, cl.UserID, cl.ID) {
+		ch.sendTypingStopped(hub.RoomID, cl.UserID)
 	}
 }
 
-// addClient adds a client to the chat with the specified ID. If the chat does not exist, it is created.
-func (ch *ChatHandler) addClient(roomID entity.ID, c *service.Client) {
-	ch.chatsMu.Lock()
-	defer ch.chatsMu.Unlock()
+// leaveAllHubs removes the client from the hubs of all rooms it is subscribed to.
+func (ch *ChatHandler) leaveAllHubs(cl *service.Client) {
+	for _, hub := range cl.Hubs() {
+		ch.leaveHub(hub, cl)
+	}
+}
 
-	chat, ok := ch.chats[roomID]
-	if !ok {
-		chat = service.NewChat(ch.broadcastBuffSize)
-		ch.chats[roomID] = chat
+// acquireHub returns the hub of the room, creating it on the first reference.
+// The entry of a new hub is reserved under the lock and subscribed to the bus outside of it,
+// so a slow bus does not block the other rooms; concurrent joins of the room wait for the subscription.
+// A hub being stopped is waited for, so a room never has two hubs at once.
+func (ch *ChatHandler) acquireHub(roomID entity.ID) (*service.Hub, error) {
+	ch.hubsMu.Lock()
+	entry, ok := ch.hubs[roomID]
+	for ok && entry.stopped != nil {
+		ch.hubsMu.Unlock()
+		<-entry.stopped
+
+		ch.hubsMu.Lock()
+		entry, ok = ch.hubs[roomID]
 	}
+	if ok {
+		entry.refs++
+		ch.hubsMu.Unlock()
 
-	chat.Clients[c] = struct{}{}
+		<-entry.ready
+		if entry.err != nil {
+			return nil, fmt.Errorf("ChatHandler.acquireHub: %w", entry.err)
+		}
+		return entry.hub, nil
+	}
+	if ch.closing.Load() {
+		ch.hubsMu.Unlock()
+		return nil, fmt.Errorf("ChatHandler.acquireHub: %w", errShuttingDown)
+	}
+	hub := service.NewHub(roomID, ch.cfg.InboundBuffSize, ch.processMessage)
+	hub.Start()
+	entry = &hubEntry{hub: hub, refs: 1, ephemeral: &ephemeralPermission{}, ready: make(chan struct{})}
+	ch.hubs[roomID] = entry
+	ch.hubsMu.Unlock()
+
+	ephemeral := entry.ephemeral
+	unsubscribe, err := ch.bus.Subscribe(context.Background(), roomID, func(ev *entity.Event) {
+		if ev.Type == entity.EventRoomUpdated {
+			ephemeral.reset()
+		}
+		hub.Deliver(ev)
+	})
+	if err != nil {
+		ch.hubsMu.Lock()
+		delete(ch.hubs, roomID)
+		ch.hubsMu.Unlock()
+		hub.Stop()
+
+		entry.err = err
+		close(entry.ready)
+		return nil, fmt.Errorf("ChatHandler.acquireHub: %w", err)
+	}
+	entry.unsubscribe = unsubscribe
+	close(entry.ready)
+	return hub, nil
 }
 
-// deleteClient removes a client from the chat with the specified ID. If there are no more clients in the chat, then the chat is deleted.
-func (ch *ChatHandler) deleteClient(roomID entity.ID, c *service.Client) {
-	ch.chatsMu.Lock()
-	delete(ch.chats[roomID].Clients, c)
-	if len(ch.chats[roomID].Clients) == 0 {
-		delete(ch.chats, roomID)
+// releaseHub drops a reference to the hub and stops it when the last reference is dropped.
+// The hub is stopped outside of the lock since it finishes processing the queued messages first,
+// its entry is kept until then so the joins of the room wait instead of creating another hub.
+func (ch *ChatHandler) releaseHub(hub *service.Hub) {
+	ch.hubsMu.Lock()
+	entry, ok := ch.hubs[hub.RoomID]
+	if !ok || entry.hub != hub {
+		ch.hubsMu.Unlock()
+		return
+	}
+	entry.refs--
+	if entry.refs > 0 {
+		ch.hubsMu.Unlock()
+		return
 	}
-	ch.chatsMu.Unlock()
+	entry.stopped = make(chan struct{})
+	ch.hubsMu.Unlock()
+
+	entry.unsubscribe()
+	hub.Stop()
+
+	ch.hubsMu.Lock()
+	delete(ch.hubs, hub.RoomID)
+	ch.hubsMu.Unlock()
+	close(entry.stopped)
 }
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"chat-server/internal/domain/entity"
+)
+
+// GetRoomPins returns the pinned messages of the room in the order they were pinned.
+func (ch *ChatHandler) GetRoomPins(c *gin.Context) {
+	roomIDInt, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Printf("error converting room ID to int: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return
+	}
+	roomID := entity.ID(roomIDInt)
+
+	pins, err := ch.messageUseCase.GetPinBulkByRoomID(roomID)
+	if err != nil {
+		log.Printf("error getting pins: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if pins == nil {
+		pins = []entity.Pin{}
+	}
+
+	log.Printf("pins retrieved: %d", roomID)
+	c.JSON(http.StatusOK, pins)
+}
+
+// PinMessage pins the message of the room and notifies the room unless it has been pinned before.
+func (ch *ChatHandler) PinMessage(c *gin.Context) {
+	req, err := getPinReq(c)
+	if err != nil {
+		return
+	}
+
+	pin, pinned, err := ch.messageUseCase.PinMessage(req)
+	if errors.Is(err, entity.ErrPinMessageRoom) {
+		log.Printf("error pinning message: %v", err)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": entity.ErrPinMessageRoom.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("error pinning message: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if pinned {
+		ch.sendEventForAllClientInRoom(pin.RoomID, entity.NewEvent(entity.EventMessagePinned, pin))
+	}
+
+	log.Printf("message pinned: %d %d", req.RoomID, req.MessageID)
+	c.JSON(http.StatusOK, pin)
+}
+
+// UnpinMessage unpins the message of the room and notifies the room if it has been pinned.
+func (ch *ChatHandler) UnpinMessage(c *gin.Context) {
+	req, err := getPinReq(c)
+	if err != nil {
+		return
+	}
+
+	pin, unpinned, err := ch.messageUseCase.UnpinMessage(req)
+	if err != nil {
+		log.Printf("error unpinning message: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if unpinned {
+		ch.sendEventForAllClientInRoom(pin.RoomID, entity.NewEvent(entity.EventMessageUnpinned, pin))
+	}
+
+	log.Printf("message unpinned: %d %d", req.RoomID, req.MessageID)
+	c.Status(http.StatusNoContent)
+}
+
+// getPinReq builds the pin request from the room and message of the path and the user.
+// The request is aborted if it returns an error.
+func getPinReq(c *gin.Context) (*entity.PinReq, error) {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Printf("error converting room ID to int: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid room ID"})
+		return nil, err
+	}
+	messageID, err := strconv.Atoi(c.Param("messageID"))
+	if err != nil {
+		log.Printf("error converting message ID to int: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return nil, err
+	}
+	userID, err := getUserID(c)
+	if err != nil {
+		log.Printf("error getting user ID: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, err
+	}
+
+	req := &entity.PinReq{
+		RoomID:    entity.ID(roomID),
+		MessageID: entity.ID(messageID),
+		UserID:    userID,
+	}
+	if err := req.Validate(); err != nil {
+		log.Printf("error validating request: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, err
+	}
+	return req, nil
+}
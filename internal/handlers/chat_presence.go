@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/service"
+)
+
+// GetUserPresence returns the status of the user to the members of the rooms the user is in.
+func (ch *ChatHandler) GetUserPresence(c *gin.Context) {
+	userIDInt, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Printf("error converting user ID to int: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	userID := entity.ID(userIDInt)
+
+	requesterID, err := getUserID(c)
+	if err != nil {
+		log.Printf("error getting user ID: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	shared, err := ch.roomUseCase.ShareRoom(requesterID, userID)
+	if err != nil {
+		log.Printf("error checking shared rooms: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !shared {
+		log.Printf("access denied to user presence: %d %d", requesterID, userID)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	presence, err := ch.presenceUseCase.GetPresence(c, userID)
+	if err != nil {
+		log.Printf("error getting user presence: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("user presence retrieved: %d %s", userID, presence.Status)
+	c.JSON(http.StatusOK, presence)
+}
+
+func (ch *ChatHandler) connectPresence(cl *service.Client) {
+	presence, changed, err := ch.presenceUseCase.Connect(context.Background(), cl.UserID, cl.ID)
+	if err != nil {
+		log.Printf("error connecting user presence: %v", err)
+		return
+	}
+	if changed {
+		ch.broadcastPresence(presence)
+	}
+}
+
+func (ch *ChatHandler) disconnectPresence(cl *service.Client) {
+	presence, changed, err := ch.presenceUseCase.Disconnect(context.Background(), cl.UserID, cl.ID)
+	if err != nil {
+		log.Printf("error disconnecting user presence: %v", err)
+		return
+	}
+	if changed {
+		ch.broadcastPresence(presence)
+	}
+}
+
+// refreshPresence keeps the connection of the client live until done is closed.
+func (ch *ChatHandler) refreshPresence(cl *service.Client, done <-chan struct{}) {
+	ticker := time.NewTicker(ch.presenceRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := ch.presenceUseCase.Refresh(context.Background(), cl.UserID, cl.ID); err != nil {
+				log.Printf("error refreshing user presence: %v", err)
+			}
+		}
+	}
+}
+
+func (ch *ChatHandler) updatePresence(cl *service.Client, status entity.PresenceStatus) error {
+	presence, changed, err := ch.presenceUseCase.SetStatus(context.Background(), cl.UserID, status)
+	if err != nil {
+		return fmt.Errorf("ChatHandler.updatePresence: %w", err)
+	}
+	if changed {
+		ch.broadcastPresence(presence)
+	}
+	return nil
+}
+
+// broadcastPresence sends the presence of the user to all rooms the user is a member of.
+func (ch *ChatHandler) broadcastPresence(presence *entity.Presence) {
+	roomIDs, err := ch.roomUseCase.GetRoomIDsByUserID(presence.UserID)
+	if err != nil {
+		log.Printf("error getting rooms of user: %v", err)
+		return
+	}
+
+	ev := entity.NewEvent(entity.EventPresenceChange, presence)
+	for _, roomID := range roomIDs {
+		ch.sendEventForAllClientInRoom(roomID, ev)
+	}
+	log.Printf("user presence broadcasted: %d %s", presence.UserID, presence.Status)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"chat-server/internal/domain/entity"
+)
+
+// AddReaction adds the reaction of the user to the message. The reaction event is published
+// to the room by BroadcastMessageUpdateMiddleware, unless the user has already reacted with the emoji.
+func (ch *ChatHandler) AddReaction(c *gin.Context) {
+	var req entity.ReactionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("error binding JSON: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := bindReactionParams(c, &req); err != nil {
+		return
+	}
+
+	change, added, err := ch.messageUseCase.AddReaction(&req)
+	if err != nil {
+		log.Printf("error adding reaction: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setReactionEvent(c, entity.EventReactionAdded, change, added)
+
+	log.Printf("reaction added: %d %d %s", req.UserID, req.MessageID, req.Emoji)
+	c.JSON(http.StatusOK, change)
+}
+
+// RemoveReaction removes the reaction of the user with the emoji of the path from the message.
+func (ch *ChatHandler) RemoveReaction(c *gin.Context) {
+	req := entity.ReactionReq{Emoji: entity.Emoji(c.Param("emoji"))}
+	if err := bindReactionParams(c, &req); err != nil {
+		return
+	}
+
+	change, removed, err := ch.messageUseCase.RemoveReaction(&req)
+	if err != nil {
+		log.Printf("error removing reaction: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setReactionEvent(c, entity.EventReactionRemoved, change, removed)
+
+	log.Printf("reaction removed: %d %d %s", req.UserID, req.MessageID, req.Emoji)
+	c.JSON(http.StatusOK, change)
+}
+
+// bindReactionParams fills the request with the message of the path and the user, and validates it.
+// The request is aborted if it returns an error.
+func bindReactionParams(c *gin.Context, req *entity.ReactionReq) error {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Printf("error converting message ID to int: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return err
+	}
+	req.MessageID = entity.ID(messageID)
+
+	req.UserID, err = getUserID(c)
+	if err != nil {
+		log.Printf("error getting user ID: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return err
+	}
+
+	if err := req.Validate(); err != nil {
+		log.Printf("error validating request: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return err
+	}
+	return nil
+}
+
+// setReactionEvent hands the reaction event over to BroadcastMessageUpdateMiddleware if the reaction has changed.
+func setReactionEvent(c *gin.Context, eventType entity.EventType, change *entity.ReactionChange, changed bool) {
+	var ev *entity.Event
+	if changed {
+		ev = entity.NewEvent(eventType, change)
+	}
+	c.Set(broadcastEventCtx, ev)
+}
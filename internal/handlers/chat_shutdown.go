@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"nhooyr.io/websocket"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/service"
+)
+
+// reconnectJitter spreads the reconnects of the clients of a shutting down server
+const reconnectJitter = 5 * time.Second
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// Shutdown stops accepting clients, processes the messages already accepted by the room hubs
+// and asks every client to reconnect, closing its connection once its queued events are written.
+// Clients still connected when the context is done are disconnected at once.
+func (ch *ChatHandler) Shutdown(ctx context.Context) error {
+	// the deliveries of the events written until the clients are gone are recorded as well
+	defer ch.deliveries.Stop()
+
+	ch.clientsMu.Lock()
+	ch.closing.Store(true)
+	clients := make([]*service.Client, 0, len(ch.clients))
+	for cl := range ch.clients {
+		clients = append(clients, cl)
+	}
+	ch.clientsMu.Unlock()
+
+	ch.hubsMu.Lock()
+	hubs := make([]*service.Hub, 0, len(ch.hubs))
+	for _, entry := range ch.hubs {
+		hubs = append(hubs, entry.hub)
+	}
+	ch.hubsMu.Unlock()
+
+	// the hubs keep delivering while draining, so the persisted messages reach the clients before they go away
+	drained := make(chan struct{})
+	go func() {
+		for _, hub := range hubs {
+			hub.Drain()
+		}
+		ch.persister.Stop()
+		close(drained)
+	}()
+	if err := waitOrDisconnect(ctx, drained, clients); err != nil {
+		return fmt.Errorf("ChatHandler.Shutdown: %w", err)
+	}
+
+	for _, cl := range clients {
+		payload := &entity.GoingAwayPayload{
+			ReconnectAfterMs: rand.Int63n(reconnectJitter.Milliseconds()),
+		}
+		cl.GoAway(entity.NewEvent(entity.EventServerGoingAway, payload))
+	}
+
+	disconnected := make(chan struct{})
+	go func() {
+		ch.sessions.Wait()
+		close(disconnected)
+	}()
+	if err := waitOrDisconnect(ctx, disconnected, clients); err != nil {
+		return fmt.Errorf("ChatHandler.Shutdown: %w", err)
+	}
+
+	log.Printf("chat shut down: %d clients", len(clients))
+	return nil
+}
+
+// waitOrDisconnect waits for done and disconnects the clients if the context is done first.
+func waitOrDisconnect(ctx context.Context, done <-chan struct{}, clients []*service.Client) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, cl := range clients {
+			cl.Disconnect(websocket.StatusGoingAway, "server is shutting down")
+		}
+		return ctx.Err()
+	}
+}
+
+// addClient tracks the client until removeClient, so it is asked to go away on shutdown.
+// It returns false if the server is shutting down.
+func (ch *ChatHandler) addClient(cl *service.Client) bool {
+	ch.clientsMu.Lock()
+	defer ch.clientsMu.Unlock()
+
+	if ch.closing.Load() {
+		return false
+	}
+	ch.clients[cl] = struct{}{}
+	ch.sessions.Add(1)
+	return true
+}
+
+func (ch *ChatHandler) removeClient(cl *service.Client) {
+	ch.clientsMu.Lock()
+	delete(ch.clients, cl)
+	ch.clientsMu.Unlock()
+
+	ch.sessions.Done()
+}
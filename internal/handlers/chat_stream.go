@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/service"
+)
+
+// StreamRoomEvents delivers the events of the room as Server-Sent Events for clients
+// that cannot open a WebSocket. The event ID is the seq of the message, so a reconnecting
+// EventSource resumes with the Last-Event-ID header.
+func (ch *ChatHandler) StreamRoomEvents(c *gin.Context) {
+	roomID, userID, err := ch.getRoomIDAndUserIDParams(c)
+	if err != nil {
+		log.Printf("error getting params: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	since, err := getLastEventID(c)
+	if err != nil {
+		log.Printf("error getting last event ID: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cl := service.NewClient(nil, ch.cfg, roomID, userID)
+	if !ch.addClient(cl) {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": errShuttingDown.Error()})
+		return
+	}
+	defer ch.removeClient(cl)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// proxies must not buffer the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	defer ch.leaveAllHubs(cl)
+
+	// the missed messages are replayed on joining, so the stream must already be written
+	writerDone := make(chan struct{})
+	go ch.writeEventStream(c.Writer, cl, writerDone)
+	// the response writer must not be used after the handler returns
+	defer func() {
+		cl.Close()
+		<-writerDone
+	}()
+
+	replay, err := ch.joinHub(cl, roomID, since)
+	if err != nil {
+		log.Printf("error joining room hub: %v", err)
+		return
+	}
+	if replay != nil {
+		go ch.replayMessages(cl, replay, since)
+	}
+
+	ch.connectPresence(cl)
+	defer ch.disconnectPresence(cl)
+	presenceDone := make(chan struct{})
+	defer close(presenceDone)
+	go ch.refreshPresence(cl, presenceDone)
+
+	log.Printf("user streams room: %d %d", userID, roomID)
+
+	select {
+	case <-c.Request.Context().Done():
+	case <-cl.Done():
+	}
+}
+
+// writeEventStream writes the events of the client to the stream until the client is closed.
+// While there are no events, a comment is written every ping interval to keep proxies from
+// closing the idle connection. A client asked to go away gets its queued events before the stream ends.
+func (ch *ChatHandler) writeEventStream(w gin.ResponseWriter, cl *service.Client, done chan<- struct{}) {
+	defer close(done)
+	// a client which cannot be written to must not block its senders
+	defer cl.Close()
+
+	ticker := time.NewTicker(ch.cfg.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev := <-cl.Message:
+			if err := ch.writeStreamEvent(w, ev); err != nil {
+				return
+			}
+			ch.Delivered(cl, ev)
+		case <-ticker.C:
+			if err := ch.writeStreamFrame(w, []byte(": keepalive\n\n")); err != nil {
+				return
+			}
+		case <-cl.GoingAway():
+			for {
+				select {
+				case ev := <-cl.Message:
+					if err := ch.writeStreamEvent(w, ev); err != nil {
+						return
+					}
+					ch.Delivered(cl, ev)
+				default:
+					return
+				}
+			}
+		case <-cl.Done():
+			return
+		}
+	}
+}
+
+func (ch *ChatHandler) writeStreamEvent(w gin.ResponseWriter, ev *entity.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("ChatHandler.writeStreamEvent: %w", err)
+	}
+	return ch.writeStreamFrame(w, encodeStreamEvent(ev, data))
+}
+
+func (ch *ChatHandler) writeStreamFrame(w gin.ResponseWriter, frame []byte) error {
+	err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(ch.cfg.WriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("error setting stream write deadline: %v", err)
+	}
+	if _, err := w.Write(frame); err != nil {
+		return fmt.Errorf("ChatHandler.writeStreamFrame: %w", err)
+	}
+	w.Flush()
+	return nil
+}
+
+func encodeStreamEvent(ev *entity.Event, data []byte) []byte {
+	var frame []byte
+	if ev.Seq != 0 {
+		frame = append(frame, "id: "+strconv.FormatUint(uint64(ev.Seq), 10)+"\n"...)
+	}
+	frame = append(frame, "event: "+string(ev.Type)+"\n"...)
+	frame = append(frame, "data: "...)
+	frame = append(frame, data...)
+	return append(frame, "\n\n"...)
+}
+
+// getLastEventID returns the seq of the last message seen by a reconnecting stream client.
+// EventSource passes it in the Last-Event-ID header, the since query parameter is used on the first connection.
+func getLastEventID(c *gin.Context) (entity.ID, error) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		return getSinceParam(c)
+	}
+	since, err := strconv.ParseUint(lastEventID, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("error converting Last-Event-ID to int: %w", err)
+	}
+	return entity.ID(since), nil
+}
+
+// PostMessage sends the message to the room through the same path as the messages received over a WebSocket,
+// so it is persisted in order and delivered to every client of the room. The message is processed asynchronously.
+func (ch *ChatHandler) PostMessage(c *gin.Context) {
+	var payload entity.NewMessagePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Printf("error binding JSON: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		log.Printf("error validating request: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	roomID, userID, err := ch.getRoomIDAndUserIDParams(c)
+	if err != nil {
+		log.Printf("error getting params: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	parentID, err := ch.threadParentID(roomID, payload.ParentID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	allowed, err := ch.rateLimitUseCase.AllowMessage(c, userID, roomID)
+	if err != nil {
+		log.Printf("error checking rate limit: %v", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "rate limit is unavailable"})
+		return
+	}
+	if !allowed {
+		log.Printf("rate limit exceeded: %d %d", userID, roomID)
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+		return
+	}
+
+	hub, err := ch.acquireHub(roomID)
+	if errors.Is(err, errShuttingDown) {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": errShuttingDown.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("error acquiring room hub: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer ch.releaseHub(hub)
+
+	msg := &entity.Message{
+		RoomID:      roomID,
+		SenderID:    userID,
+		Content:     payload.Content,
+		ClientNonce: payload.Nonce,
+		ParentID:    parentID,
+	}
+	if !hub.Submit(msg) {
+		log.Printf("error submitting message: hub of room %d is stopped", roomID)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "room is unavailable"})
+		return
+	}
+
+	log.Printf("message accepted: %d %d", userID, roomID)
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"nhooyr.io/websocket"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/service"
+)
+
+// Connect serves a single WebSocket for all rooms of the user.
+// The client chooses the rooms it receives events of with subscription frames.
+func (ch *ChatHandler) Connect(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		log.Printf("error getting user ID: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ch.closing.Load() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": errShuttingDown.Error()})
+		return
+	}
+
+	conn, err := ch.acceptWebSocket(c)
+	if err != nil {
+		log.Printf("error accepting WebSocket connection: %v", err)
+		return
+	}
+	defer conn.Close(websocket.StatusInternalError, "")
+
+	cl := service.NewClient(conn, ch.cfg, 0, userID)
+	if !ch.addClient(cl) {
+		conn.Close(websocket.StatusGoingAway, errShuttingDown.Error())
+		return
+	}
+	defer ch.removeClient(cl)
+	defer cl.Close()
+	defer ch.leaveAllHubs(cl)
+
+	go cl.WriteMessage(ch)
+
+	log.Printf("user connected: %d", userID)
+
+	ch.serveClient(cl)
+}
+
+// eventHub returns the hub of the room the event is addressed to.
+// An event without a room is addressed to the room joined through /chat/joinRoom.
+func (ch *ChatHandler) eventHub(cl *service.Client, ev *entity.InboundEvent) (*service.Hub, error) {
+	roomID := ev.RoomID
+	if roomID == 0 {
+		roomID = cl.RoomID
+	}
+	hub, ok := cl.Hub(roomID)
+	if !ok {
+		return nil, entity.NewProtocolError(entity.ErrCodeNotSubscribed, "not subscribed to room %d", roomID)
+	}
+	return hub, nil
+}
+
+// subscribeRoom starts the delivery of the events of the room to the client if the user has access to it.
+// The messages after the one passed in since are replayed first, the acknowledgement is held until
+// the replay ends like the live events. Subscribing to a room twice is not an error.
+func (ch *ChatHandler) subscribeRoom(cl *service.Client, ev *entity.InboundEvent) error {
+	if ev.RoomID == 0 {
+		return entity.NewProtocolError(entity.ErrCodeMalformedFrame, "room ID is empty")
+	}
+
+	var payload entity.RoomSubscribePayload
+	if len(ev.Payload) > 0 {
+		if err := ev.DecodePayload(&payload); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := cl.Hub(ev.RoomID); !ok {
+		hasAccess, err := ch.roomUseCase.HasRoomAccess(ev.RoomID, cl.UserID)
+		if err != nil {
+			return fmt.Errorf("ChatHandler.subscribeRoom: %w", err)
+		}
+		if !hasAccess {
+			return entity.NewProtocolError(entity.ErrCodeForbidden, "access denied to room %d", ev.RoomID)
+		}
+		replay, err := ch.joinHub(cl, ev.RoomID, payload.Since)
+		if err != nil {
+			return fmt.Errorf("ChatHandler.subscribeRoom: %w", err)
+		}
+		if replay != nil {
+			// the replay must not keep the connection from being read, or its pongs would not be received
+			go ch.replayMessages(cl, replay, payload.Since)
+		}
+		log.Printf("user subscribed to room: %d %d", cl.UserID, ev.RoomID)
+	}
+
+	ack := entity.NewEvent(entity.EventRoomSubscribed, nil)
+	ack.ID = ev.ID
+	ack.RoomID = ev.RoomID
+	cl.Send(ack)
+	return nil
+}
+
+// unsubscribeRoom stops the delivery of the events of the room to the client.
+// The events queued before are still written, the acknowledgement comes after them.
+func (ch *ChatHandler) unsubscribeRoom(cl *service.Client, ev *entity.InboundEvent) error {
+	hub, err := ch.eventHub(cl, ev)
+	if err != nil {
+		return err
+	}
+	ch.leaveHub(hub, cl)
+	log.Printf("user unsubscribed from room: %d %d", cl.UserID, hub.RoomID)
+
+	ack := entity.NewEvent(entity.EventRoomUnsubscribed, nil)
+	ack.ID = ev.ID
+	ack.RoomID = hub.RoomID
+	cl.Send(ack)
+	return nil
+}
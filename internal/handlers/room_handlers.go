@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"strconv"
@@ -14,11 +15,17 @@ import (
 
 type RoomHandler struct {
 	roomUseCase use_case.RoomUseCase
+	bus         use_case.BroadcastBus
 }
 
-func NewRoomHandler(roomUseCase use_case.RoomUseCase, logger *logrus.Logger) *RoomHandler {
+func NewRoomHandler(
+	roomUseCase use_case.RoomUseCase,
+	bus use_case.BroadcastBus,
+	logger *logrus.Logger,
+) *RoomHandler {
 	return &RoomHandler{
 		roomUseCase: roomUseCase,
+		bus:         bus,
 	}
 }
 
@@ -90,6 +97,13 @@ func (r *RoomHandler) PatchRoomInfo(c *gin.Context) {
 		return
 	}
 
+	// the hubs of the room on every server instance drop the settings they have cached
+	ev := entity.NewEvent(entity.EventRoomUpdated, res)
+	ev.RoomID = res.ID
+	if err := r.bus.Publish(context.Background(), res.ID, ev); err != nil {
+		log.Printf("Error publishing room update: %v", err)
+	}
+
 	log.Printf("Successfully edited room info for ID: %v", roomIDInt)
 	c.JSON(http.StatusOK, res)
 }
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"chat-server/internal/domain/entity"
+	dml "chat-server/pkg/db"
+)
+
+type DeliveryCursorRepository struct {
+	db *sql.DB
+}
+
+func NewDeliveryCursorRepository(db *sql.DB) *DeliveryCursorRepository {
+	return &DeliveryCursorRepository{
+		db: db,
+	}
+}
+
+func (r *DeliveryCursorRepository) UpsertDeliveryCursor(
+	cursor *entity.DeliveryCursor,
+) (*entity.DeliveryCursor, entity.ID, error) {
+	query := dml.UpsertDeliveryCursorQuery
+	var previousID entity.ID
+	err := r.db.QueryRow(query, cursor.RoomID, cursor.UserID, cursor.LastDeliveredMessageID).
+		Scan(&cursor.LastDeliveredMessageID, &cursor.UpdatedAt, &previousID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("DeliveryCursorRepository.UpsertDeliveryCursor: %w", err)
+	}
+	return cursor, previousID, nil
+}
+
+func (r *DeliveryCursorRepository) SelectDeliveryCursorBulkByRoomID(
+	roomID entity.ID,
+) ([]entity.DeliveryCursor, error) {
+	query := dml.SelectDeliveryCursorBulkByRoomIDQuery
+	rows, err := r.db.Query(query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("DeliveryCursorRepository.SelectDeliveryCursorBulkByRoomID: %w", err)
+	}
+	defer rows.Close()
+
+	var cursors []entity.DeliveryCursor
+	for rows.Next() {
+		var cursor entity.DeliveryCursor
+		err := rows.Scan(&cursor.RoomID, &cursor.UserID, &cursor.LastDeliveredMessageID, &cursor.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("DeliveryCursorRepository.SelectDeliveryCursorBulkByRoomID: %w", err)
+		}
+		cursors = append(cursors, cursor)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("DeliveryCursorRepository.SelectDeliveryCursorBulkByRoomID: %w", err)
+	}
+	return cursors, nil
+}
@@ -47,6 +47,26 @@ func (m *MemberRepository) SelectMemberBulkByRoomID(roomID entity.ID) ([]entity.
 	return members, nil
 }
 
+func (m *MemberRepository) SelectMemberBulkByUserID(userID entity.ID) ([]entity.Member, error) {
+	query := dml.SelectMemberBulkByUserIDQuery
+	rows, err := m.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("MemberRepository.SelectMemberBulkByUserID: %w", err)
+	}
+	defer rows.Close()
+
+	var members []entity.Member
+	for rows.Next() {
+		var member entity.Member
+		err := rows.Scan(&member.RoomID, &member.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("MemberRepository.SelectMemberBulkByUserID: %w", err)
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
 func (m *MemberRepository) UpdateMember(member *entity.Member) (*entity.Member, error) {
 	query := dml.UpdateMemberQuery
 	_, err := m.db.Exec(query, member.RoomID, member.UserID, member.RoomID, member.UserID)
@@ -3,8 +3,13 @@ package repository
 import (
 	"database/sql"
 	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
 
 	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
 	dml "chat-server/pkg/db"
 )
 
@@ -20,20 +25,137 @@ func NewMessageRepository(db *sql.DB) *MessageRepository {
 
 func (m *MessageRepository) InsertMessage(message *entity.Message) (*entity.Message, error) {
 	query := dml.InsertMessageQuery
-	err := m.db.QueryRow(query, message.SenderID, message.RoomID, message.Content).
-		Scan(&message.ID, &message.CreatedAt)
+	err := m.db.QueryRow(
+		query,
+		message.SenderID,
+		message.RoomID,
+		message.Content,
+		message.ClientNonce,
+		message.ParentID,
+	).Scan(&message.ID, &message.CreatedAt)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("MessageRepository.InsertMessage: %w", use_case.ErrMessageDuplicate)
+		}
 		return nil, fmt.Errorf("MessageRepository.InsertMessage: %w", err)
 	}
 	return message, nil
 }
 
+// InsertMessageBulk takes the IDs of the messages from the sequence beforehand,
+// since the rows returned by a multi-row insert cannot be matched to the messages otherwise.
+func (m *MessageRepository) InsertMessageBulk(messages []*entity.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids, err := m.selectMessageIDBulk(len(messages))
+	if err != nil {
+		return fmt.Errorf("MessageRepository.InsertMessageBulk: %w", err)
+	}
+
+	byID := make(map[entity.ID]*entity.Message, len(messages))
+	msgIDs := make([]int64, len(messages))
+	senderIDs := make([]int64, len(messages))
+	roomIDs := make([]int64, len(messages))
+	contents := make([]string, len(messages))
+	nonces := make([]string, len(messages))
+	parentIDs := make([]int64, len(messages))
+	for i, message := range messages {
+		byID[ids[i]] = message
+		msgIDs[i] = int64(ids[i])
+		senderIDs[i] = int64(message.SenderID)
+		roomIDs[i] = int64(message.RoomID)
+		contents[i] = string(message.Content)
+		nonces[i] = message.ClientNonce
+		parentIDs[i] = int64(message.ParentID)
+		// a message skipped as a duplicate is not returned and keeps the zero ID
+		message.ID = 0
+	}
+
+	query := dml.InsertMessageBulkQuery
+	rows, err := m.db.Query(
+		query,
+		pq.Array(msgIDs),
+		pq.Array(senderIDs),
+		pq.Array(roomIDs),
+		pq.Array(contents),
+		pq.Array(nonces),
+		pq.Array(parentIDs),
+	)
+	if err != nil {
+		return fmt.Errorf("MessageRepository.InsertMessageBulk: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id entity.ID
+		var createdAt time.Time
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			return fmt.Errorf("MessageRepository.InsertMessageBulk: %w", err)
+		}
+		message := byID[id]
+		message.ID = id
+		message.CreatedAt = &createdAt
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("MessageRepository.InsertMessageBulk: %w", err)
+	}
+	return nil
+}
+
+// selectMessageIDBulk takes count IDs from the sequence of the messages in ascending order.
+func (m *MessageRepository) selectMessageIDBulk(count int) ([]entity.ID, error) {
+	query := dml.SelectMessageIDBulkQuery
+	rows, err := m.db.Query(query, count)
+	if err != nil {
+		return nil, fmt.Errorf("MessageRepository.selectMessageIDBulk: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]entity.ID, 0, count)
+	for rows.Next() {
+		var id entity.ID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("MessageRepository.selectMessageIDBulk: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("MessageRepository.selectMessageIDBulk: %w", err)
+	}
+	if len(ids) != count {
+		return nil, fmt.Errorf("MessageRepository.selectMessageIDBulk: got %d IDs, expected %d", len(ids), count)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (m *MessageRepository) SelectMessageByClientNonce(senderID entity.ID, nonce string) (*entity.Message, error) {
+	query := dml.SelectMessageByClientNonceQuery
+	message := &entity.Message{}
+	err := m.db.QueryRow(query, senderID, nonce).Scan(&message.ID, &message.SenderID, &message.RoomID,
+		&message.Content, &message.Status, &message.CreatedAt, &message.UpdatedAt, &message.DeletedAt, &message.ClientNonce,
+		&message.ParentID, &message.RevisionCount, &message.Edited)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("MessageRepository.SelectMessageByClientNonce: %w", use_case.ErrMessageNonceDeleted)
+		}
+		return nil, fmt.Errorf("MessageRepository.SelectMessageByClientNonce: %w", err)
+	}
+	return message, nil
+}
+
 func (m *MessageRepository) SelectMessage(id entity.ID) (*entity.Message, error) {
 	query := dml.SelectMessageQuery
 	message := &entity.Message{}
 	err := m.db.QueryRow(query, id).Scan(&message.ID, &message.SenderID, &message.RoomID,
-		&message.Content, &message.Status, &message.CreatedAt, &message.UpdatedAt, &message.DeletedAt)
+		&message.Content, &message.Status, &message.CreatedAt, &message.UpdatedAt, &message.DeletedAt, &message.ClientNonce,
+		&message.ParentID, &message.RevisionCount, &message.Edited)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("MessageRepository.SelectMessage: %w", use_case.ErrMessageNotFound)
+		}
 		return nil, fmt.Errorf("MessageRepository.SelectMessage: %w", err)
 	}
 	return message, nil
@@ -55,6 +177,102 @@ func (m *MessageRepository) UpdateMessage(message *entity.Message) error {
 	return nil
 }
 
+// UpdateMessageContent replaces the content of the active message, keeping the previous one as a revision.
+func (m *MessageRepository) UpdateMessageContent(message *entity.Message) error {
+	query := dml.UpdateMessageContentQuery
+	err := m.db.QueryRow(query, message.ID, message.Content).Scan(&message.RevisionCount, &message.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("MessageRepository.UpdateMessageContent: %w", err)
+	}
+	message.Edited = true
+	return nil
+}
+
+func (m *MessageRepository) SelectRevisionBulkByMessageID(messageID entity.ID) ([]entity.MessageRevision, error) {
+	query := dml.SelectRevisionBulkByMessageIDQuery
+	rows, err := m.db.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("MessageRepository.SelectRevisionBulkByMessageID: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []entity.MessageRevision
+	for rows.Next() {
+		var revision entity.MessageRevision
+		err := rows.Scan(&revision.MessageID, &revision.Revision, &revision.Content,
+			&revision.WrittenAt, &revision.ReplacedAt)
+		if err != nil {
+			return nil, fmt.Errorf("MessageRepository.SelectRevisionBulkByMessageID: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("MessageRepository.SelectRevisionBulkByMessageID: %w", err)
+	}
+	return revisions, nil
+}
+
+func (m *MessageRepository) MarkReadMessageBulk(
+	roomID entity.ID,
+	fromID entity.ID,
+	upToID entity.ID,
+	readerID entity.ID,
+) error {
+	query := dml.MarkReadMessageBulkQuery
+	_, err := m.db.Exec(query, roomID, fromID, upToID, readerID)
+	if err != nil {
+		return fmt.Errorf("MessageRepository.MarkReadMessageBulk: %w", err)
+	}
+	return nil
+}
+
+func (m *MessageRepository) MarkDeliveredMessageBulk(
+	roomID entity.ID,
+	fromID entity.ID,
+	upToID entity.ID,
+	recipientID entity.ID,
+) error {
+	query := dml.MarkDeliveredMessageBulkQuery
+	_, err := m.db.Exec(query, roomID, fromID, upToID, recipientID)
+	if err != nil {
+		return fmt.Errorf("MessageRepository.MarkDeliveredMessageBulk: %w", err)
+	}
+	return nil
+}
+
+func (m *MessageRepository) MarkDeliveredMessageBulkByID(
+	roomID entity.ID,
+	ids []entity.ID,
+	recipientID entity.ID,
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	messageIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		messageIDs[i] = int64(id)
+	}
+
+	query := dml.MarkDeliveredMessageBulkByIDQuery
+	_, err := m.db.Exec(query, roomID, pq.Array(messageIDs), recipientID)
+	if err != nil {
+		return fmt.Errorf("MessageRepository.MarkDeliveredMessageBulkByID: %w", err)
+	}
+	return nil
+}
+
+func (m *MessageRepository) SelectReceiptCounts(id entity.ID) (*entity.ReceiptCounts, error) {
+	query := dml.SelectReceiptCountsQuery
+	counts := &entity.ReceiptCounts{}
+	err := m.db.QueryRow(query, id).Scan(&counts.MessageID, &counts.DeliveredCount,
+		&counts.ReadCount, &counts.RecipientCount)
+	if err != nil {
+		return nil, fmt.Errorf("MessageRepository.SelectReceiptCounts: %w", err)
+	}
+	return counts, nil
+}
+
 func (m *MessageRepository) SoftDeleteMessageByID(id entity.ID) error {
 	query := dml.SoftDeleteMessageByIDQuery
 	_, err := m.db.Exec(query, id)
@@ -73,60 +291,127 @@ func (m *MessageRepository) SoftDeleteMessageBulkByRoomID(roomID entity.ID) erro
 	return nil
 }
 
-func (m *MessageRepository) SelectMessageBulkPaginate(
+// SelectMessageBulkBeforeID selects the latest active messages of the room if beforeID is zero.
+func (m *MessageRepository) SelectMessageBulkBeforeID(
 	roomID entity.ID,
-	perPage uint,
-	page uint,
+	beforeID entity.ID,
+	limit uint,
 ) ([]entity.Message, error) {
 	var messages []entity.Message
-	offset := perPage * (page - 1)
-	query := dml.SelectMessageBulkPaginateQuery
-	rows, err := m.db.Query(query, roomID, perPage, offset)
+	var rows *sql.Rows
+	var err error
+	if beforeID == 0 {
+		rows, err = m.db.Query(dml.SelectMessageBulkLatestQuery, roomID, limit)
+	} else {
+		rows, err = m.db.Query(dml.SelectMessageBulkBeforeIDQuery, roomID, beforeID, limit)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("MessageRepository.SelectMessageBulkPaginate: %w", err)
+		return nil, fmt.Errorf("MessageRepository.SelectMessageBulkBeforeID: %w", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var message entity.Message
 		err = rows.Scan(&message.ID, &message.SenderID, &message.RoomID, &message.Content,
-			&message.Status, &message.CreatedAt, &message.UpdatedAt, &message.DeletedAt)
+			&message.Status, &message.CreatedAt, &message.UpdatedAt, &message.DeletedAt, &message.ClientNonce,
+			&message.ParentID, &message.RevisionCount, &message.Edited)
 		if err != nil {
-			return nil, fmt.Errorf("MessageRepository.SelectMessageBulkPaginate: %w", err)
+			return nil, fmt.Errorf("MessageRepository.SelectMessageBulkBeforeID: %w", err)
 		}
 		messages = append(messages, message)
 	}
 	err = rows.Err()
 	if err != nil {
-		return nil, fmt.Errorf("MessageRepository.SelectMessageBulkPaginate: %w", err)
+		return nil, fmt.Errorf("MessageRepository.SelectMessageBulkBeforeID: %w", err)
 	}
 	return messages, nil
 }
 
-func (m *MessageRepository) SelectMessageBulkPaginateReverse(
+func (m *MessageRepository) SelectMessageBulkAfterID(
 	roomID entity.ID,
-	perPage uint,
-	page uint,
+	afterID entity.ID,
+	limit uint,
 ) ([]entity.Message, error) {
 	var messages []entity.Message
-	offset := (page - 1) * perPage
-	query := dml.SelectMessageBulkPaginateReverseQuery
-	rows, err := m.db.Query(query, roomID, perPage, offset)
+	query := dml.SelectMessageBulkAfterIDQuery
+	rows, err := m.db.Query(query, roomID, afterID, limit)
 	if err != nil {
-		return nil, fmt.Errorf("MessageRepository.SelectMessageBulkPaginateReverse: %w", err)
+		return nil, fmt.Errorf("MessageRepository.SelectMessageBulkAfterID: %w", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var message entity.Message
 		err = rows.Scan(&message.ID, &message.SenderID, &message.RoomID, &message.Content,
-			&message.Status, &message.CreatedAt, &message.UpdatedAt, &message.DeletedAt)
+			&message.Status, &message.CreatedAt, &message.UpdatedAt, &message.DeletedAt, &message.ClientNonce,
+			&message.ParentID, &message.RevisionCount, &message.Edited)
 		if err != nil {
-			return nil, fmt.Errorf("MessageRepository.SelectMessageBulkPaginateReverse: %w", err)
+			return nil, fmt.Errorf("MessageRepository.SelectMessageBulkAfterID: %w", err)
 		}
 		messages = append(messages, message)
 	}
 	err = rows.Err()
 	if err != nil {
-		return nil, fmt.Errorf("MessageRepository.SelectMessageBulkPaginateReverse: %w", err)
+		return nil, fmt.Errorf("MessageRepository.SelectMessageBulkAfterID: %w", err)
 	}
 	return messages, nil
 }
+
+func (m *MessageRepository) SelectThreadReplyBulkAfterID(
+	parentID entity.ID,
+	afterID entity.ID,
+	limit uint,
+) ([]entity.Message, error) {
+	var messages []entity.Message
+	query := dml.SelectThreadReplyBulkAfterIDQuery
+	rows, err := m.db.Query(query, parentID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("MessageRepository.SelectThreadReplyBulkAfterID: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var message entity.Message
+		err = rows.Scan(&message.ID, &message.SenderID, &message.RoomID, &message.Content,
+			&message.Status, &message.CreatedAt, &message.UpdatedAt, &message.DeletedAt, &message.ClientNonce,
+			&message.ParentID, &message.RevisionCount, &message.Edited)
+		if err != nil {
+			return nil, fmt.Errorf("MessageRepository.SelectThreadReplyBulkAfterID: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("MessageRepository.SelectThreadReplyBulkAfterID: %w", err)
+	}
+	return messages, nil
+}
+
+func (m *MessageRepository) SelectThreadSummaryBulk(parentIDs []entity.ID) ([]entity.ThreadSummary, error) {
+	if len(parentIDs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, len(parentIDs))
+	for i, id := range parentIDs {
+		ids[i] = int64(id)
+	}
+
+	var summaries []entity.ThreadSummary
+	query := dml.SelectThreadSummaryBulkQuery
+	rows, err := m.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("MessageRepository.SelectThreadSummaryBulk: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var summary entity.ThreadSummary
+		err = rows.Scan(&summary.ParentID, &summary.ReplyCount, &summary.LastReplyAt)
+		if err != nil {
+			return nil, fmt.Errorf("MessageRepository.SelectThreadSummaryBulk: %w", err)
+		}
+		summaries = append(summaries, summary)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("MessageRepository.SelectThreadSummaryBulk: %w", err)
+	}
+	return summaries, nil
+}
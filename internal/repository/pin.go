@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"chat-server/internal/domain/entity"
+	dml "chat-server/pkg/db"
+)
+
+type PinRepository struct {
+	db *sql.DB
+}
+
+func NewPinRepository(db *sql.DB) *PinRepository {
+	return &PinRepository{
+		db: db,
+	}
+}
+
+func (r *PinRepository) InsertPin(pin *entity.Pin) (*entity.Pin, bool, error) {
+	query := dml.InsertPinQuery
+	err := r.db.QueryRow(query, pin.RoomID, pin.MessageID, pin.PinnedBy).Scan(&pin.PinnedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return pin, false, nil
+		}
+		return nil, false, fmt.Errorf("PinRepository.InsertPin: %w", err)
+	}
+	return pin, true, nil
+}
+
+func (r *PinRepository) DeletePin(roomID entity.ID, messageID entity.ID) (bool, error) {
+	query := dml.DeletePinQuery
+	res, err := r.db.Exec(query, roomID, messageID)
+	if err != nil {
+		return false, fmt.Errorf("PinRepository.DeletePin: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("PinRepository.DeletePin: %w", err)
+	}
+	return rowsAffected != 0, nil
+}
+
+func (r *PinRepository) SelectPinBulkByRoomID(roomID entity.ID) ([]entity.Pin, error) {
+	query := dml.SelectPinBulkByRoomIDQuery
+	rows, err := r.db.Query(query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("PinRepository.SelectPinBulkByRoomID: %w", err)
+	}
+	defer rows.Close()
+
+	var pins []entity.Pin
+	for rows.Next() {
+		var pin entity.Pin
+		message := &entity.Message{}
+		err := rows.Scan(&pin.RoomID, &pin.MessageID, &pin.PinnedBy, &pin.PinnedAt,
+			&message.ID, &message.SenderID, &message.RoomID, &message.Content, &message.Status,
+			&message.CreatedAt, &message.UpdatedAt, &message.DeletedAt, &message.ClientNonce, &message.ParentID,
+			&message.RevisionCount, &message.Edited)
+		if err != nil {
+			return nil, fmt.Errorf("PinRepository.SelectPinBulkByRoomID: %w", err)
+		}
+		pin.Message = message
+		pins = append(pins, pin)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("PinRepository.SelectPinBulkByRoomID: %w", err)
+	}
+	return pins, nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"chat-server/internal/domain/entity"
+	dml "chat-server/pkg/db"
+)
+
+type ReactionRepository struct {
+	db *sql.DB
+}
+
+func NewReactionRepository(db *sql.DB) *ReactionRepository {
+	return &ReactionRepository{
+		db: db,
+	}
+}
+
+func (r *ReactionRepository) InsertReaction(messageID entity.ID, userID entity.ID, emoji entity.Emoji) (bool, error) {
+	query := dml.InsertReactionQuery
+	res, err := r.db.Exec(query, messageID, userID, emoji)
+	if err != nil {
+		return false, fmt.Errorf("ReactionRepository.InsertReaction: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ReactionRepository.InsertReaction: %w", err)
+	}
+	return rowsAffected != 0, nil
+}
+
+func (r *ReactionRepository) DeleteReaction(messageID entity.ID, userID entity.ID, emoji entity.Emoji) (bool, error) {
+	query := dml.DeleteReactionQuery
+	res, err := r.db.Exec(query, messageID, userID, emoji)
+	if err != nil {
+		return false, fmt.Errorf("ReactionRepository.DeleteReaction: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ReactionRepository.DeleteReaction: %w", err)
+	}
+	return rowsAffected != 0, nil
+}
+
+func (r *ReactionRepository) SelectReactionCount(messageID entity.ID, emoji entity.Emoji) (int, error) {
+	query := dml.SelectReactionCountQuery
+	var count int
+	if err := r.db.QueryRow(query, messageID, emoji).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ReactionRepository.SelectReactionCount: %w", err)
+	}
+	return count, nil
+}
+
+func (r *ReactionRepository) SelectReactionCountBulk(
+	messageIDs []entity.ID,
+	userID entity.ID,
+) ([]entity.MessageReactionCount, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, len(messageIDs))
+	for i, id := range messageIDs {
+		ids[i] = int64(id)
+	}
+
+	query := dml.SelectReactionCountBulkQuery
+	rows, err := r.db.Query(query, pq.Array(ids), userID)
+	if err != nil {
+		return nil, fmt.Errorf("ReactionRepository.SelectReactionCountBulk: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []entity.MessageReactionCount
+	for rows.Next() {
+		var count entity.MessageReactionCount
+		err := rows.Scan(&count.MessageID, &count.Emoji, &count.Count, &count.ReactedByMe)
+		if err != nil {
+			return nil, fmt.Errorf("ReactionRepository.SelectReactionCountBulk: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ReactionRepository.SelectReactionCountBulk: %w", err)
+	}
+	return counts, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"chat-server/internal/domain/entity"
+	dml "chat-server/pkg/db"
+)
+
+type ReadCursorRepository struct {
+	db *sql.DB
+}
+
+func NewReadCursorRepository(db *sql.DB) *ReadCursorRepository {
+	return &ReadCursorRepository{
+		db: db,
+	}
+}
+
+func (r *ReadCursorRepository) UpsertReadCursor(
+	cursor *entity.ReadCursor,
+) (*entity.ReadCursor, entity.ID, error) {
+	query := dml.UpsertReadCursorQuery
+	var previousID entity.ID
+	err := r.db.QueryRow(query, cursor.RoomID, cursor.UserID, cursor.LastReadMessageID).
+		Scan(&cursor.LastReadMessageID, &cursor.UpdatedAt, &previousID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ReadCursorRepository.UpsertReadCursor: %w", err)
+	}
+	return cursor, previousID, nil
+}
+
+func (r *ReadCursorRepository) SelectReadCursorBulkByRoomID(
+	roomID entity.ID,
+) ([]entity.ReadCursor, error) {
+	query := dml.SelectReadCursorBulkByRoomIDQuery
+	rows, err := r.db.Query(query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("ReadCursorRepository.SelectReadCursorBulkByRoomID: %w", err)
+	}
+	defer rows.Close()
+
+	var cursors []entity.ReadCursor
+	for rows.Next() {
+		var cursor entity.ReadCursor
+		err := rows.Scan(&cursor.RoomID, &cursor.UserID, &cursor.LastReadMessageID, &cursor.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("ReadCursorRepository.SelectReadCursorBulkByRoomID: %w", err)
+		}
+		cursors = append(cursors, cursor)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ReadCursorRepository.SelectReadCursorBulkByRoomID: %w", err)
+	}
+	return cursors, nil
+}
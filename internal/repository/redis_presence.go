@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+// redisPresenceRepository keeps the live connections of a user in a sorted set
+// scored by the expiration time, so connections of a crashed instance expire on their own.
+type redisPresenceRepository struct {
+	redis *redis.Client
+}
+
+func NewPresenceCacheRepository(redisClient *redis.Client) use_case.PresenceStorage {
+	return &redisPresenceRepository{
+		redis: redisClient,
+	}
+}
+
+func connectionsKey(userID entity.ID) string {
+	return fmt.Sprintf("presence:%d:conns", userID)
+}
+
+func statusKey(userID entity.ID) string {
+	return fmt.Sprintf("presence:%d:status", userID)
+}
+
+func (r *redisPresenceRepository) AddConnection(
+	ctx context.Context,
+	userID entity.ID,
+	connID string,
+	ttl time.Duration,
+) (int64, error) {
+	key := connectionsKey(userID)
+	now := time.Now()
+	var count *redis.IntCmd
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: connID})
+		pipe.Expire(ctx, key, ttl)
+		count = pipe.ZCard(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("redisPresenceRepository.AddConnection: %w", err)
+	}
+	return count.Val(), nil
+}
+
+func (r *redisPresenceRepository) RefreshConnection(
+	ctx context.Context,
+	userID entity.ID,
+	connID string,
+	ttl time.Duration,
+) error {
+	key := connectionsKey(userID)
+	expiresAt := float64(time.Now().Add(ttl).UnixMilli())
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: expiresAt, Member: connID})
+		pipe.Expire(ctx, key, ttl)
+		pipe.Expire(ctx, statusKey(userID), ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redisPresenceRepository.RefreshConnection: %w", err)
+	}
+	return nil
+}
+
+func (r *redisPresenceRepository) RemoveConnection(
+	ctx context.Context,
+	userID entity.ID,
+	connID string,
+) (int64, error) {
+	key := connectionsKey(userID)
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	var count *redis.IntCmd
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, key, connID)
+		pipe.ZRemRangeByScore(ctx, key, "-inf", now)
+		count = pipe.ZCard(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("redisPresenceRepository.RemoveConnection: %w", err)
+	}
+	return count.Val(), nil
+}
+
+func (r *redisPresenceRepository) CountConnections(
+	ctx context.Context,
+	userID entity.ID,
+) (int64, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	count, err := r.redis.ZCount(ctx, connectionsKey(userID), "("+now, "+inf").Result()
+	if err != nil {
+		return 0, fmt.Errorf("redisPresenceRepository.CountConnections: %w", err)
+	}
+	return count, nil
+}
+
+// SetStatus stores the status and returns the previous one or an empty status if there was none.
+func (r *redisPresenceRepository) SetStatus(
+	ctx context.Context,
+	userID entity.ID,
+	status entity.PresenceStatus,
+	ttl time.Duration,
+) (entity.PresenceStatus, error) {
+	args := redis.SetArgs{TTL: ttl, Get: true}
+	prev, err := r.redis.SetArgs(ctx, statusKey(userID), string(status), args).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", fmt.Errorf("redisPresenceRepository.SetStatus: %w", err)
+	}
+	return entity.PresenceStatus(prev), nil
+}
+
+// GetStatus returns the stored status or an empty status if there is none.
+func (r *redisPresenceRepository) GetStatus(
+	ctx context.Context,
+	userID entity.ID,
+) (entity.PresenceStatus, error) {
+	status, err := r.redis.Get(ctx, statusKey(userID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		return "", fmt.Errorf("redisPresenceRepository.GetStatus: %w", err)
+	}
+	return entity.PresenceStatus(status), nil
+}
+
+func (r *redisPresenceRepository) DeleteStatus(ctx context.Context, userID entity.ID) error {
+	if err := r.redis.Del(ctx, statusKey(userID)).Err(); err != nil {
+		return fmt.Errorf("redisPresenceRepository.DeleteStatus: %w", err)
+	}
+	return nil
+}
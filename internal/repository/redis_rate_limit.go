@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+// takeTokenScript refills the token buckets in KEYS by the time elapsed since their last update
+// and takes a token from each of them only if all of them have one. ARGV holds the rate and
+// the burst of every bucket. The Redis clock is used, so the buckets are shared by all server instances.
+var takeTokenScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local tokens = {}
+local allowed = 1
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2 - 1])
+	local burst = tonumber(ARGV[i * 2])
+	local state = redis.call('HMGET', key, 'tokens', 'ts')
+	local available = tonumber(state[1]) or burst
+	local ts = tonumber(state[2]) or now
+	available = math.min(burst, available + math.max(0, now - ts) * rate / 1000)
+	if available < 1 then
+		allowed = 0
+	end
+	tokens[i] = available
+end
+
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2 - 1])
+	local burst = tonumber(ARGV[i * 2])
+	redis.call('HSET', key, 'tokens', tokens[i] - allowed, 'ts', now)
+	redis.call('PEXPIRE', key, math.ceil(burst / rate * 1000))
+end
+return allowed
+`)
+
+type redisRateLimitRepository struct {
+	redis *redis.Client
+}
+
+func NewRateLimitRepository(redisClient *redis.Client) use_case.RateLimitStorage {
+	return &redisRateLimitRepository{
+		redis: redisClient,
+	}
+}
+
+func userRateLimitKey(userID entity.ID) string {
+	return fmt.Sprintf("ratelimit:%d", userID)
+}
+
+func roomRateLimitKey(userID entity.ID, roomID entity.ID) string {
+	return fmt.Sprintf("ratelimit:%d:room:%d", userID, roomID)
+}
+
+func (r *redisRateLimitRepository) TakeMessageToken(
+	ctx context.Context,
+	userID entity.ID,
+	roomID entity.ID,
+	userLimit entity.RateLimit,
+	roomLimit entity.RateLimit,
+) (bool, error) {
+	keys := []string{userRateLimitKey(userID), roomRateLimitKey(userID, roomID)}
+	allowed, err := takeTokenScript.Run(
+		ctx,
+		r.redis,
+		keys,
+		userLimit.Rate,
+		userLimit.Burst,
+		roomLimit.Rate,
+		roomLimit.Burst,
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("redisRateLimitRepository.TakeMessageToken: %w", err)
+	}
+	return allowed == 1, nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+type redisTicketRepository struct {
+	redis *redis.Client
+}
+
+func NewTicketRepository(redisClient *redis.Client) use_case.TicketStorage {
+	return &redisTicketRepository{
+		redis: redisClient,
+	}
+}
+
+func ticketKey(value string) string {
+	return fmt.Sprintf("ticket:%s", value)
+}
+
+func (r *redisTicketRepository) SaveTicket(
+	ctx context.Context,
+	ticket *entity.Ticket,
+	ttl time.Duration,
+) error {
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return fmt.Errorf("redisTicketRepository.SaveTicket: %w", err)
+	}
+	if err := r.redis.Set(ctx, ticketKey(ticket.Value), data, ttl).Err(); err != nil {
+		return fmt.Errorf("redisTicketRepository.SaveTicket: %w", err)
+	}
+	return nil
+}
+
+func (r *redisTicketRepository) TakeTicket(ctx context.Context, value string) (*entity.Ticket, error) {
+	data, err := r.redis.GetDel(ctx, ticketKey(value)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("redisTicketRepository.TakeTicket: %w", use_case.ErrTicketNotFound)
+		}
+		return nil, fmt.Errorf("redisTicketRepository.TakeTicket: %w", err)
+	}
+
+	var ticket entity.Ticket
+	if err := json.Unmarshal(data, &ticket); err != nil {
+		return nil, fmt.Errorf("redisTicketRepository.TakeTicket: %w", err)
+	}
+	ticket.Value = value
+	return &ticket, nil
+}
@@ -24,7 +24,7 @@ func (r *RoomRepository) InsertRoom(room *entity.Room) (*entity.Room, error) {
 		return nil, fmt.Errorf("RoomRepository.InsertRoom: %w", use_case.ErrRoomInvalid)
 	}
 	query := dml.InsertRoomQuery
-	err := r.db.QueryRow(query, room.OwnerID, room.Name).Scan(&room.ID)
+	err := r.db.QueryRow(query, room.OwnerID, room.Name).Scan(&room.ID, &room.AllowEphemeral)
 	if err != nil {
 		return nil, fmt.Errorf("RoomRepository.InsertRoom: %w", err)
 	}
@@ -34,7 +34,7 @@ func (r *RoomRepository) InsertRoom(room *entity.Room) (*entity.Room, error) {
 func (r *RoomRepository) SelectRoomByID(id entity.ID) (*entity.Room, error) {
 	query := dml.SelectRoomByIDQuery
 	var room entity.Room
-	err := r.db.QueryRow(query, id).Scan(&room.ID, &room.OwnerID, &room.Name)
+	err := r.db.QueryRow(query, id).Scan(&room.ID, &room.OwnerID, &room.Name, &room.AllowEphemeral)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("RoomRepository.SelectRoomByID: %w", use_case.ErrRoomNotFound)
@@ -49,7 +49,7 @@ func (r *RoomRepository) UpdateRoom(room *entity.Room) error {
 		return fmt.Errorf("RoomRepository.UpdateRoom: %w", use_case.ErrRoomInvalid)
 	}
 	query := dml.UpdateRoomQuery
-	res, err := r.db.Exec(query, room.Name, room.ID)
+	res, err := r.db.Exec(query, room.Name, room.AllowEphemeral, room.ID)
 	if err != nil {
 		return fmt.Errorf("RoomRepository.UpdateRoom: %w", err)
 	}
@@ -1,6 +1,9 @@
 package route
 
 import (
+	"context"
+	"expvar"
+
 	"github.com/gin-gonic/gin"
 
 	"chat-server/internal/handlers"
@@ -26,6 +29,11 @@ func NewRouter(
 	}
 }
 
+// Shutdown disconnects the chat clients, which the HTTP server does not track.
+func (r *Router) Shutdown(ctx context.Context) error {
+	return r.chatHandler.Shutdown(ctx)
+}
+
 func (r *Router) SetupRouter() *gin.Engine {
 	// auth
 	auth := r.route.Group("/auth")
@@ -62,6 +70,37 @@ func (r *Router) SetupRouter() *gin.Engine {
 		r.authHandler.UserExistMiddlewareByParam("userID"),
 		r.roomHandler.AddMemberToRoomHandler,
 	)
+	room.GET("/:id/events",
+		r.authHandler.UserIdentity,
+		r.roomHandler.RoomExistsMiddlewareByParam("id"),
+		r.roomHandler.RoomAccessMiddlewareByParam("id"),
+		r.chatHandler.StreamRoomEvents,
+	)
+	room.POST("/:id/messages",
+		r.authHandler.UserIdentity,
+		r.roomHandler.RoomExistsMiddlewareByParam("id"),
+		r.roomHandler.RoomAccessMiddlewareByParam("id"),
+		r.chatHandler.PostMessage,
+	)
+	room.GET("/:id/pins",
+		r.authHandler.UserIdentity,
+		r.roomHandler.RoomExistsMiddlewareByParam("id"),
+		r.roomHandler.RoomAccessMiddlewareByParam("id"),
+		r.chatHandler.GetRoomPins,
+	)
+	// pinning is up to the owner of the room
+	room.POST("/:id/pins/:messageID",
+		r.authHandler.UserIdentity,
+		r.roomHandler.RoomExistsMiddlewareByParam("id"),
+		r.roomHandler.RoomPermissionsMiddleware,
+		r.chatHandler.PinMessage,
+	)
+	room.DELETE("/:id/pins/:messageID",
+		r.authHandler.UserIdentity,
+		r.roomHandler.RoomExistsMiddlewareByParam("id"),
+		r.roomHandler.RoomPermissionsMiddleware,
+		r.chatHandler.UnpinMessage,
+	)
 	room.DELETE("/:id/messages",
 		r.authHandler.UserIdentity,
 		r.roomHandler.RoomExistsMiddlewareByParam("id"),
@@ -69,13 +108,29 @@ func (r *Router) SetupRouter() *gin.Engine {
 		r.chatHandler.DeleteAllMessageFromRoom,
 	)
 
+	// user
+	users := r.route.Group("/users")
+	users.GET("/:id/presence",
+		r.authHandler.UserIdentity,
+		r.authHandler.UserExistMiddlewareByParam("id"),
+		r.chatHandler.GetUserPresence,
+	)
+
 	// chat
+	r.route.POST("/chat/tickets",
+		r.authHandler.UserIdentity,
+		r.authHandler.IssueTicket,
+	)
 	r.route.GET("/chat/joinRoom/:id",
-		r.authHandler.UserIdentityByQueryParam("access_token"),
+		r.authHandler.UserIdentityByTicket("ticket", "access_token", "id"),
 		r.roomHandler.RoomExistsMiddlewareByParam("id"),
 		r.roomHandler.RoomAccessMiddlewareByParam("id"),
 		r.chatHandler.JoinRoom,
 	)
+	r.route.GET("/ws",
+		r.authHandler.UserIdentityByTicket("ticket", "access_token", ""),
+		r.chatHandler.Connect,
+	)
 
 	// message
 	messages := r.route.Group("/messages")
@@ -85,6 +140,33 @@ func (r *Router) SetupRouter() *gin.Engine {
 		r.roomHandler.RoomAccessMiddlewareByParam("roomID"),
 		r.chatHandler.GetMessageBulkPaginate,
 	)
+	messages.GET("/:id/thread",
+		r.authHandler.UserIdentity,
+		r.chatHandler.MessageAccessMiddlewareByParam("id"),
+		r.chatHandler.GetThread,
+	)
+	messages.POST("/:id/reactions",
+		r.authHandler.UserIdentity,
+		r.chatHandler.MessageAccessMiddlewareByParam("id"),
+		r.chatHandler.BroadcastMessageUpdateMiddleware,
+		r.chatHandler.AddReaction,
+	)
+	messages.DELETE("/:id/reactions/:emoji",
+		r.authHandler.UserIdentity,
+		r.chatHandler.MessageAccessMiddlewareByParam("id"),
+		r.chatHandler.BroadcastMessageUpdateMiddleware,
+		r.chatHandler.RemoveReaction,
+	)
+	messages.GET("/:id/revisions",
+		r.authHandler.UserIdentity,
+		r.chatHandler.MessageAuditMiddlewareByParam("id"),
+		r.chatHandler.GetMessageRevisions,
+	)
+	messages.POST("/:id/read",
+		r.authHandler.UserIdentity,
+		r.chatHandler.MessageAccessMiddlewareByParam("id"),
+		r.chatHandler.MarkMessageRead,
+	)
 	messages.PATCH("/:id",
 		r.authHandler.UserIdentity,
 		r.chatHandler.MessagePermissionMiddlewareByParam("id"),
@@ -100,3 +182,13 @@ func (r *Router) SetupRouter() *gin.Engine {
 
 	return r.route
 }
+
+// SetupAdminRouter serves the metrics on a listener of its own, which is not exposed to the clients.
+func (r *Router) SetupAdminRouter() *gin.Engine {
+	admin := gin.New()
+
+	// metrics
+	admin.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+
+	return admin
+}
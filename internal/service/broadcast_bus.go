@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+type busSubscription struct {
+	handler func(ev *entity.Event)
+}
+
+// memoryBroadcastBus delivers events within a single process.
+type memoryBroadcastBus struct {
+	mu   sync.RWMutex
+	subs map[entity.ID]map[*busSubscription]struct{}
+}
+
+func NewMemoryBroadcastBus() use_case.BroadcastBus {
+	return &memoryBroadcastBus{
+		subs: make(map[entity.ID]map[*busSubscription]struct{}),
+	}
+}
+
+func (b *memoryBroadcastBus) Publish(_ context.Context, roomID entity.ID, ev *entity.Event) error {
+	b.mu.RLock()
+	handlers := make([]func(ev *entity.Event), 0, len(b.subs[roomID]))
+	for sub := range b.subs[roomID] {
+		handlers = append(handlers, sub.handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(ev)
+	}
+	return nil
+}
+
+func (b *memoryBroadcastBus) Subscribe(
+	_ context.Context,
+	roomID entity.ID,
+	handler func(ev *entity.Event),
+) (func(), error) {
+	sub := &busSubscription{handler: handler}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[roomID]; !ok {
+		b.subs[roomID] = make(map[*busSubscription]struct{})
+	}
+	b.subs[roomID][sub] = struct{}{}
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[roomID], sub)
+		if len(b.subs[roomID]) == 0 {
+			delete(b.subs, roomID)
+		}
+	}, nil
+}
+
+func (b *memoryBroadcastBus) Close() error {
+	return nil
+}
@@ -2,69 +2,377 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"nhooyr.io/websocket"
 
 	"chat-server/internal/domain/entity"
 )
 
-type Chat struct {
-	Broadcast              chan *entity.Message
-	BroadcastManagerStatus bool
-	Clients                map[*Client]struct{}
-}
+// StatusSlowConsumer is the close code of a client that does not keep up with the events of its room.
+const StatusSlowConsumer websocket.StatusCode = 4000
 
-func NewChat(bcBuffSize int) *Chat {
-	return &Chat{
-		Broadcast: make(chan *entity.Message, bcBuffSize),
-		Clients:   make(map[*Client]struct{}),
+// StatusIdleTimeout is the close code of a client that has not answered pings or sent frames for too long.
+const StatusIdleTimeout websocket.StatusCode = 4001
 
-		BroadcastManagerStatus: false,
-	}
+// DeliveryHandler is notified of the events written to a client.
+type DeliveryHandler interface {
+	Delivered(cl *Client, ev *entity.Event)
+}
+
+// EventHandler handles validated events received from a client.
+// A returned *entity.ProtocolError is sent back to the client as an error frame.
+type EventHandler interface {
+	HandleEvent(cl *Client, ev *entity.InboundEvent) error
 }
 
 type Client struct {
+	// ID identifies the connection among all connections of all server instances
+	ID string
+	// Conn is nil for a client of a Server-Sent Events stream, whose events are written by the handler
 	Conn    *websocket.Conn
-	Message chan *entity.Message
-	RoomID  entity.ID
-	UserID  entity.ID
+	Message chan *entity.Event
+	// RoomID is the room joined through /chat/joinRoom, it is zero for a client of /ws
+	RoomID entity.ID
+	UserID entity.ID
+
+	writeTimeout    time.Duration
+	pingInterval    time.Duration
+	pongTimeout     time.Duration
+	readIdleTimeout time.Duration
+
+	codec Codec
+
+	// lastSeenAt is the Unix time in nanoseconds of the last frame or pong received from the client
+	lastSeenAt atomic.Int64
+
+	closeOnce  sync.Once
+	done       chan struct{}
+	goAwayOnce sync.Once
+	goingAway  chan struct{}
+
+	// replays keeps the replays in progress holding the live events of their rooms
+	// and replayedUpTo keeps the last replayed message of the rooms whose live events may still repeat it
+	replayMu     sync.Mutex
+	replays      map[entity.ID]*Replay
+	replayedUpTo map[entity.ID]entity.ID
+
+	// lastTypingAt, frameTokens, framesRefilledAt, violations and hubs are accessed
+	// only by the goroutine reading the connection
+	lastTypingAt     time.Time
+	frameTokens      float64
+	framesRefilledAt time.Time
+	violations       int
+	hubs             map[entity.ID]*Hub
 }
 
 func NewClient(
 	conn *websocket.Conn,
-	messageBuffSize int,
+	cfg *ChatConfig,
 	roomID entity.ID,
 	userID entity.ID,
 ) *Client {
-	return &Client{
-		Conn:    conn,
-		Message: make(chan *entity.Message, messageBuffSize),
-		RoomID:  roomID,
-		UserID:  userID,
+	codec := CodecBySubprotocol("")
+	if conn != nil {
+		codec = CodecBySubprotocol(conn.Subprotocol())
+	}
+
+	cl := &Client{
+		ID:              newConnID(),
+		Conn:            conn,
+		Message:         make(chan *entity.Event, cfg.SendBuffSize),
+		RoomID:          roomID,
+		UserID:          userID,
+		writeTimeout:    cfg.WriteTimeout,
+		pingInterval:    cfg.PingInterval,
+		pongTimeout:     cfg.PongTimeout,
+		readIdleTimeout: cfg.ReadIdleTimeout,
+		codec:           codec,
+		done:            make(chan struct{}),
+		goingAway:       make(chan struct{}),
+		hubs:            make(map[entity.ID]*Hub),
+		replays:         make(map[entity.ID]*Replay),
+		replayedUpTo:    make(map[entity.ID]entity.ID),
 	}
+	cl.touch()
+	return cl
 }
 
-func (c *Client) WriteMessage() {
+// Heartbeat pings the client until it is closed. A client that does not answer a ping
+// within the pong timeout or sends no data frames longer than the read idle timeout is disconnected,
+// which makes its ReadMessage return. Pongs keep the connection alive but do not count as activity.
+func (c *Client) Heartbeat() {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
 	for {
-		message, ok := <-c.Message
-		if !ok {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		idle := time.Since(time.Unix(0, c.lastSeenAt.Load()))
+		if idle > c.readIdleTimeout {
+			c.Conn.Close(StatusIdleTimeout, "read idle timeout")
 			return
 		}
 
-		messageBytes, err := json.Marshal(message)
+		ctx, cancel := context.WithTimeout(context.Background(), c.pongTimeout)
+		err := c.Conn.Ping(ctx)
+		cancel()
 		if err != nil {
+			c.Conn.Close(StatusIdleTimeout, "pong timeout")
+			return
+		}
+	}
+}
+
+func (c *Client) touch() {
+	c.lastSeenAt.Store(time.Now().UnixNano())
+}
+
+// Send queues the event for writing to the client without blocking. A client whose send buffer
+// is full is disconnected as a slow consumer. It returns false if the event is not queued.
+func (c *Client) Send(ev *entity.Event) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+
+	if c.isReplayed(ev) {
+		return true
+	}
+	if replay, ok := c.replays[ev.RoomID]; ok {
+		if len(replay.held) >= cap(c.Message) {
+			c.closeSlow()
+			return false
+		}
+		replay.held = append(replay.held, ev)
+		return true
+	}
+	return c.queue(ev)
+}
+
+// SendWait queues the event waiting for space in the send buffer.
+// It returns false if the client is closed.
+func (c *Client) SendWait(ev *entity.Event) bool {
+	select {
+	case c.Message <- ev:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// Replay is the replay of the messages of a room missed by the client.
+// The live events of the room are held from Hold until Release, so they follow the replayed messages.
+type Replay struct {
+	roomID entity.ID
+	held   []*entity.Event
+	// lastID is accessed only by the goroutine replaying the messages
+	lastID entity.ID
+}
+
+// RoomID returns the room whose messages are replayed.
+func (r *Replay) RoomID() entity.ID {
+	return r.roomID
+}
+
+// Hold makes the client hold the live events of the room until the replay is released,
+// so the messages missed by the client can be replayed before them.
+func (c *Client) Hold(roomID entity.ID) *Replay {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+
+	replay := &Replay{roomID: roomID}
+	c.replays[roomID] = replay
+	delete(c.replayedUpTo, roomID)
+	return replay
+}
+
+// SendReplayed queues the replayed event waiting for space in the send buffer. It returns false
+// if the client is closed or the replay is over, because the client has left the room.
+func (c *Client) SendReplayed(replay *Replay, ev *entity.Event) bool {
+	c.replayMu.Lock()
+	active := c.replays[replay.roomID] == replay
+	c.replayMu.Unlock()
+	if !active || !c.SendWait(ev) {
+		return false
+	}
+	if ev.Seq > replay.lastID {
+		replay.lastID = ev.Seq
+	}
+	return true
+}
+
+// Release queues the events held for the room, unless the client has left the room during the replay.
+// The live events of the messages up to the last replayed one are dropped, including the ones
+// published after the release, until an event of a later message arrives.
+func (c *Client) Release(replay *Replay) {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+
+	if c.replays[replay.roomID] != replay {
+		return
+	}
+	delete(c.replays, replay.roomID)
+	if replay.lastID != 0 {
+		c.replayedUpTo[replay.roomID] = replay.lastID
+	}
+	for _, ev := range replay.held {
+		if c.isReplayed(ev) {
+			continue
+		}
+		if !c.queue(ev) {
 			return
 		}
+	}
+}
+
+// isReplayed reports whether the event carries a message already replayed to the client.
+// The last replayed message of the room is forgotten once an event of a later message arrives.
+func (c *Client) isReplayed(ev *entity.Event) bool {
+	if ev.Seq == 0 || (ev.Type != entity.EventMessageNew && ev.Type != entity.EventThreadReply) {
+		return false
+	}
+	upTo, ok := c.replayedUpTo[ev.RoomID]
+	if !ok {
+		return false
+	}
+	if ev.Seq <= upTo {
+		return true
+	}
+	delete(c.replayedUpTo, ev.RoomID)
+	return false
+}
+
+// queue puts the event into the send buffer without blocking.
+func (c *Client) queue(ev *entity.Event) bool {
+	select {
+	case c.Message <- ev:
+		return true
+	default:
+		c.closeSlow()
+		return false
+	}
+}
+
+// closeSlow disconnects the client that has overflowed its send buffer.
+func (c *Client) closeSlow() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		slowConsumerDisconnects.Add(1)
+		if c.Conn != nil {
+			// closing waits for the close handshake, so it must not block the sender
+			go c.Conn.Close(StatusSlowConsumer, "send buffer overflow")
+		}
+	})
+}
+
+// Close stops writing to the client. Events sent afterwards are dropped.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// Disconnect closes the client and its connection with the status code without blocking.
+func (c *Client) Disconnect(code websocket.StatusCode, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.Conn != nil {
+			// closing waits for the close handshake, which needs the connection to be read
+			go c.Conn.Close(code, reason)
+		}
+	})
+}
+
+// GoAway sends the event to the client after the events already queued.
+// Once they are written, the connection is closed with StatusGoingAway.
+func (c *Client) GoAway(ev *entity.Event) {
+	c.Send(ev)
+	c.goAwayOnce.Do(func() {
+		close(c.goingAway)
+	})
+}
+
+// GoingAway returns a channel that is closed when the client is asked to go away.
+func (c *Client) GoingAway() <-chan struct{} {
+	return c.goingAway
+}
+
+// Done returns a channel that is closed when the client is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// WriteMessage writes the events of the client to its connection until the client is closed,
+// notifying the handler of every event written.
+func (c *Client) WriteMessage(handler DeliveryHandler) {
+	// a client which cannot be written to must not block its senders
+	defer c.Close()
 
-		if err := c.Conn.Write(context.Background(), websocket.MessageText, messageBytes); err != nil {
+	for {
+		select {
+		case event := <-c.Message:
+			if err := c.write(event); err != nil {
+				return
+			}
+			handler.Delivered(c, event)
+		case <-c.goingAway:
+			if err := c.flush(handler); err != nil {
+				return
+			}
+			c.Conn.Close(websocket.StatusGoingAway, "server is shutting down")
+			return
+		case <-c.done:
 			return
 		}
 	}
 }
 
-func (c *Client) ReadMessage(broadcast chan *entity.Message) {
+// flush writes the events queued for the client.
+func (c *Client) flush(handler DeliveryHandler) error {
+	for {
+		select {
+		case event := <-c.Message:
+			if err := c.write(event); err != nil {
+				return err
+			}
+			handler.Delivered(c, event)
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) write(event *entity.Event) error {
+	eventBytes, err := c.codec.Encode(event)
+	if err != nil {
+		return fmt.Errorf("Client.write: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.writeTimeout)
+	defer cancel()
+	if err := c.Conn.Write(ctx, c.codec.MessageType(), eventBytes); err != nil {
+		return fmt.Errorf("Client.write: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) ReadMessage(handler EventHandler) {
 	for {
 		_, m, err := c.Conn.Read(context.Background())
 		if err != nil {
@@ -74,13 +382,115 @@ func (c *Client) ReadMessage(broadcast chan *entity.Message) {
 			}
 			return
 		}
+		c.touch()
+
+		ev, err := c.codec.Decode(m)
+		if err == nil {
+			err = handler.HandleEvent(c, ev)
+		}
+		if err != nil {
+			c.sendError(ev, err)
+		}
+	}
+}
 
-		msg := &entity.Message{
-			RoomID:   c.RoomID,
-			SenderID: c.UserID,
-			Content:  entity.NonEmptyString(m),
+// AllowTyping reports whether a typing event may be accepted from the client,
+// allowing at most one such event per interval.
+func (c *Client) AllowTyping(interval time.Duration) bool {
+	now := time.Now()
+	if now.Sub(c.lastTypingAt) < interval {
+		return false
+	}
+	c.lastTypingAt = now
+	return true
+}
+
+// AllowFrame takes a token from the bucket of the connection limiting its frames other than messages
+// and reports whether the frame may be accepted. The bucket starts full.
+func (c *Client) AllowFrame(limit entity.RateLimit) bool {
+	now := time.Now()
+	if c.framesRefilledAt.IsZero() {
+		c.frameTokens = float64(limit.Burst)
+	} else {
+		c.frameTokens += now.Sub(c.framesRefilledAt).Seconds() * limit.Rate
+		if c.frameTokens > float64(limit.Burst) {
+			c.frameTokens = float64(limit.Burst)
 		}
+	}
+	c.framesRefilledAt = now
+
+	if c.frameTokens < 1 {
+		return false
+	}
+	c.frameTokens--
+	return true
+}
+
+// AddViolation counts a frame of the client rejected by the rate limit. The client is disconnected
+// once it has sent maxViolations such frames in a row.
+func (c *Client) AddViolation(maxViolations int) {
+	rateLimitedFrames.Add(1)
+	c.violations++
+	if c.violations >= maxViolations {
+		rateLimitDisconnects.Add(1)
+		c.Disconnect(websocket.StatusPolicyViolation, "rate limit exceeded")
+	}
+}
+
+// ResetViolations is called when a frame of the client is accepted by the rate limit.
+func (c *Client) ResetViolations() {
+	c.violations = 0
+}
+
+// Hub returns the hub of the room the client is subscribed to.
+func (c *Client) Hub(roomID entity.ID) (*Hub, bool) {
+	hub, ok := c.hubs[roomID]
+	return hub, ok
+}
+
+// AddHub subscribes the client to the room of the hub.
+func (c *Client) AddHub(hub *Hub) {
+	c.hubs[hub.RoomID] = hub
+}
+
+// RemoveHub unsubscribes the client from the room of the hub.
+func (c *Client) RemoveHub(hub *Hub) {
+	delete(c.hubs, hub.RoomID)
+
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	delete(c.replays, hub.RoomID)
+	delete(c.replayedUpTo, hub.RoomID)
+}
+
+// Hubs returns the hubs of all rooms the client is subscribed to.
+func (c *Client) Hubs() []*Hub {
+	hubs := make([]*Hub, 0, len(c.hubs))
+	for _, hub := range c.hubs {
+		hubs = append(hubs, hub)
+	}
+	return hubs
+}
+
+// sendError answers the inbound event with an error frame.
+// Errors that are not protocol errors are reported as internal ones without details.
+func (c *Client) sendError(ev *entity.InboundEvent, err error) {
+	var protoErr *entity.ProtocolError
+	if !errors.As(err, &protoErr) {
+		protoErr = entity.NewProtocolError(entity.ErrCodeInternal, "internal server error")
+	}
+
+	var id string
+	if ev != nil {
+		id = ev.ID
+	}
+	c.Send(entity.NewErrorEvent(id, protoErr))
+}
 
-		broadcast <- msg
+func newConnID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("newConnID: %w", err))
 	}
+	return hex.EncodeToString(b)
 }
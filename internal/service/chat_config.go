@@ -0,0 +1,37 @@
+package service
+
+import (
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+type ChatConfig struct {
+	// SendBuffSize is how many events may be queued for a client before it is disconnected as a slow consumer
+	SendBuffSize int
+	// InboundBuffSize is how many messages received from clients may be queued in a room hub
+	InboundBuffSize int
+	// WriteTimeout bounds writing of one frame to a client
+	WriteTimeout time.Duration
+
+	// PingInterval is how often the server pings a client
+	PingInterval time.Duration
+	// PongTimeout is how long the server waits for a pong before disconnecting a client
+	PongTimeout time.Duration
+	// ReadIdleTimeout is how long a client may stay silent, pongs included, before it is disconnected
+	ReadIdleTimeout time.Duration
+
+	CompressionMode websocket.CompressionMode
+	// CompressionThreshold is the minimal size of a frame to be compressed
+	CompressionThreshold int
+	// OriginPatterns are the host patterns of the cross-origin pages allowed to connect
+	OriginPatterns []string
+	// MaxMessageSize is the maximal size of an inbound frame, a larger one closes the connection
+	MaxMessageSize int64
+
+	// ShutdownTimeout bounds draining of the clients on shutdown
+	ShutdownTimeout time.Duration
+
+	// DeliveryFlushInterval is how often the deliveries of messages to the clients move the delivery cursors
+	DeliveryFlushInterval time.Duration
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/json"
+
+	"nhooyr.io/websocket"
+
+	"chat-server/internal/domain/entity"
+)
+
+// WebSocket subprotocols of the wire formats of chat events.
+const (
+	SubprotocolJSON    = "chat.v1.json"
+	SubprotocolMsgpack = "chat.v1.msgpack"
+)
+
+// Codec encodes the events written to a client and decodes the frames read from it
+// in the wire format negotiated through the WebSocket subprotocol.
+type Codec interface {
+	Subprotocol() string
+	MessageType() websocket.MessageType
+	Encode(ev *entity.Event) ([]byte, error)
+	// Decode returns a *entity.ProtocolError if the frame is malformed or invalid.
+	Decode(data []byte) (*entity.InboundEvent, error)
+}
+
+var codecs = []Codec{
+	msgpackCodec{},
+	jsonCodec{},
+}
+
+// Subprotocols returns the subprotocols of the codecs in the order of preference.
+func Subprotocols() []string {
+	subprotocols := make([]string, 0, len(codecs))
+	for _, codec := range codecs {
+		subprotocols = append(subprotocols, codec.Subprotocol())
+	}
+	return subprotocols
+}
+
+// CodecBySubprotocol returns the codec of the negotiated subprotocol.
+// Clients that negotiate no subprotocol use JSON.
+func CodecBySubprotocol(subprotocol string) Codec {
+	for _, codec := range codecs {
+		if codec.Subprotocol() == subprotocol {
+			return codec
+		}
+	}
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+// jsonInboundEvent is the wire form of an event received in JSON.
+type jsonInboundEvent struct {
+	Version int              `json:"v"`
+	Type    entity.EventType `json:"type"`
+	ID      string           `json:"id"`
+	RoomID  entity.ID        `json:"room_id"`
+	Payload json.RawMessage  `json:"payload"`
+}
+
+func (jsonCodec) Subprotocol() string {
+	return SubprotocolJSON
+}
+
+func (jsonCodec) MessageType() websocket.MessageType {
+	return websocket.MessageText
+}
+
+func (jsonCodec) Encode(ev *entity.Event) ([]byte, error) {
+	return json.Marshal(ev)
+}
+
+func (jsonCodec) Decode(data []byte) (*entity.InboundEvent, error) {
+	var wire jsonInboundEvent
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, entity.NewProtocolError(entity.ErrCodeMalformedFrame, "%v", err)
+	}
+	ev := &entity.InboundEvent{
+		Version:          wire.Version,
+		Type:             wire.Type,
+		ID:               wire.ID,
+		RoomID:           wire.RoomID,
+		Payload:          wire.Payload,
+		UnmarshalPayload: json.Unmarshal,
+	}
+	if err := ev.Validate(); err != nil {
+		return ev, err
+	}
+	return ev, nil
+}
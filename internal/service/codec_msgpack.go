@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"nhooyr.io/websocket"
+
+	"chat-server/internal/domain/entity"
+)
+
+// msgpackCodec encodes events in MessagePack. Field names are the same as in JSON.
+type msgpackCodec struct{}
+
+// msgpackInboundEvent is the wire form of an event received in MessagePack.
+type msgpackInboundEvent struct {
+	Version int                `msgpack:"v"`
+	Type    entity.EventType   `msgpack:"type"`
+	ID      string             `msgpack:"id"`
+	RoomID  entity.ID          `msgpack:"room_id"`
+	Payload msgpack.RawMessage `msgpack:"payload"`
+}
+
+func (msgpackCodec) Subprotocol() string {
+	return SubprotocolMsgpack
+}
+
+func (msgpackCodec) MessageType() websocket.MessageType {
+	return websocket.MessageBinary
+}
+
+func (msgpackCodec) Encode(ev *entity.Event) ([]byte, error) {
+	// events received from other server instances carry their payload in JSON
+	if raw, ok := ev.Payload.(json.RawMessage); ok {
+		payload, err := decodeJSONValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("msgpackCodec.Encode: %w", err)
+		}
+		converted := *ev
+		converted.Payload = payload
+		ev = &converted
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+	enc.Reset(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(ev); err != nil {
+		return nil, fmt.Errorf("msgpackCodec.Encode: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Decode(data []byte) (*entity.InboundEvent, error) {
+	var wire msgpackInboundEvent
+	if err := msgpack.Unmarshal(data, &wire); err != nil {
+		return nil, entity.NewProtocolError(entity.ErrCodeMalformedFrame, "%v", err)
+	}
+	ev := &entity.InboundEvent{
+		Version:          wire.Version,
+		Type:             wire.Type,
+		ID:               wire.ID,
+		RoomID:           wire.RoomID,
+		Payload:          wire.Payload,
+		UnmarshalPayload: unmarshalMsgpack,
+	}
+	if err := ev.Validate(); err != nil {
+		return ev, err
+	}
+	return ev, nil
+}
+
+// unmarshalMsgpack decodes MessagePack into the types declared with JSON tags.
+func unmarshalMsgpack(data []byte, v interface{}) error {
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+	dec.Reset(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// decodeJSONValue decodes JSON keeping integers as integers, so they stay compact in MessagePack.
+func decodeJSONValue(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return convertJSONNumbers(v), nil
+}
+
+func convertJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = convertJSONNumbers(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertJSONNumbers(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
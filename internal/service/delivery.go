@@ -0,0 +1,95 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"chat-server/internal/domain/entity"
+)
+
+type deliveryKey struct {
+	roomID entity.ID
+	userID entity.ID
+}
+
+// DeliveryTracker coalesces the deliveries of messages to users, so a burst of messages
+// written to the clients of a user moves the delivery cursor of the user once per interval.
+type DeliveryTracker struct {
+	interval time.Duration
+	onFlush  func(roomID entity.ID, userID entity.ID, messageID entity.ID)
+
+	mu      sync.Mutex
+	pending map[deliveryKey]entity.ID
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewDeliveryTracker(
+	interval time.Duration,
+	onFlush func(roomID entity.ID, userID entity.ID, messageID entity.ID),
+) *DeliveryTracker {
+	return &DeliveryTracker{
+		interval: interval,
+		onFlush:  onFlush,
+		pending:  make(map[deliveryKey]entity.ID),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start starts the goroutine of the tracker. Subsequent calls do nothing.
+func (t *DeliveryTracker) Start() {
+	t.startOnce.Do(func() {
+		t.wg.Add(1)
+		go t.run()
+	})
+}
+
+// Stop flushes the pending deliveries and waits for the goroutine of the tracker to exit.
+func (t *DeliveryTracker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.done)
+	})
+	t.wg.Wait()
+}
+
+// Delivered records that the messages of the room up to the given one have been delivered to the user.
+func (t *DeliveryTracker) Delivered(roomID entity.ID, userID entity.ID, messageID entity.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := deliveryKey{roomID: roomID, userID: userID}
+	if messageID > t.pending[key] {
+		t.pending[key] = messageID
+	}
+}
+
+func (t *DeliveryTracker) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.flush()
+		case <-t.done:
+			t.flush()
+			return
+		}
+	}
+}
+
+func (t *DeliveryTracker) flush() {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[deliveryKey]entity.ID, len(pending))
+	t.mu.Unlock()
+
+	for key, messageID := range pending {
+		t.onFlush(key.roomID, key.userID, messageID)
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"sync"
+
+	"chat-server/internal/domain/entity"
+)
+
+// Hub is the actor of one room on this server instance. Its run goroutine owns the client set
+// and fans events out, while its process goroutine handles inbound messages one by one,
+// so messages of the room are persisted in the order they were received.
+type Hub struct {
+	RoomID entity.ID
+
+	register   chan *Client
+	unregister chan *Client
+	deliver    chan *entity.Event
+	inbound    chan *entity.Message
+
+	process func(msg *entity.Message)
+	clients map[*Client]struct{}
+
+	startOnce sync.Once
+	drainOnce sync.Once
+	stopOnce  sync.Once
+	draining  chan struct{}
+	drained   chan struct{}
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewHub(roomID entity.ID, inboundBuffSize int, process func(msg *entity.Message)) *Hub {
+	return &Hub{
+		RoomID:     roomID,
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		deliver:    make(chan *entity.Event),
+		inbound:    make(chan *entity.Message, inboundBuffSize),
+		process:    process,
+		clients:    make(map[*Client]struct{}),
+		draining:   make(chan struct{}),
+		drained:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start starts the goroutines of the hub. Subsequent calls do nothing.
+func (h *Hub) Start() {
+	h.startOnce.Do(func() {
+		h.wg.Add(2)
+		go h.run()
+		go h.processInbound()
+	})
+}
+
+// Stop stops the hub after the inbound messages already queued are processed
+// and waits for its goroutines to exit.
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.done)
+	})
+	h.wg.Wait()
+}
+
+// Drain stops accepting inbound messages and waits for the queued ones to be processed.
+// Unlike Stop, the hub keeps delivering events, so the processed messages reach its clients.
+func (h *Hub) Drain() {
+	h.drainOnce.Do(func() {
+		close(h.draining)
+	})
+	<-h.drained
+}
+
+// Register adds the client to the hub. It must not be called after Stop.
+func (h *Hub) Register(cl *Client) {
+	select {
+	case h.register <- cl:
+	case <-h.done:
+	}
+}
+
+// Unregister removes the client from the hub.
+func (h *Hub) Unregister(cl *Client) {
+	select {
+	case h.unregister <- cl:
+	case <-h.done:
+	}
+}
+
+// Deliver sends the event to the clients of the hub. Events delivered after Stop are dropped.
+func (h *Hub) Deliver(ev *entity.Event) {
+	select {
+	case h.deliver <- ev:
+	case <-h.done:
+	}
+}
+
+// Submit queues the message received from a client for processing.
+// It returns false if the hub is stopped.
+func (h *Hub) Submit(msg *entity.Message) bool {
+	select {
+	case <-h.done:
+		return false
+	case <-h.draining:
+		return false
+	default:
+	}
+
+	select {
+	case h.inbound <- msg:
+		return true
+	case <-h.done:
+		return false
+	case <-h.draining:
+		return false
+	}
+}
+
+func (h *Hub) run() {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case cl := <-h.register:
+			h.clients[cl] = struct{}{}
+		case cl := <-h.unregister:
+			delete(h.clients, cl)
+		case ev := <-h.deliver:
+			for cl := range h.clients {
+				if ev.ExceptUserID != 0 && cl.UserID == ev.ExceptUserID {
+					continue
+				}
+				if ev.ToUserID != 0 && cl.UserID != ev.ToUserID {
+					continue
+				}
+				cl.Send(ev)
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (h *Hub) processInbound() {
+	defer h.wg.Done()
+	defer close(h.drained)
+
+	for {
+		select {
+		case msg := <-h.inbound:
+			h.process(msg)
+		case <-h.draining:
+			h.drainInbound()
+			return
+		case <-h.done:
+			// messages accepted before the stop are still processed
+			h.drainInbound()
+			return
+		}
+	}
+}
+
+func (h *Hub) drainInbound() {
+	for {
+		select {
+		case msg := <-h.inbound:
+			h.process(msg)
+		default:
+			return
+		}
+	}
+}
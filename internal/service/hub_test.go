@@ -0,0 +1,233 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chat-server/internal/domain/entity"
+)
+
+const testRoomID entity.ID = 1
+
+func newTestEvent(roomID entity.ID, seq entity.ID) *entity.Event {
+	ev := entity.NewEvent(entity.EventMessageNew, nil)
+	ev.RoomID = roomID
+	ev.Seq = seq
+	return ev
+}
+
+// stopHub stops the hub, failing the test if its goroutines do not exit in time.
+func stopHub(t *testing.T, hub *Hub) {
+	t.Helper()
+
+	stopped := make(chan struct{})
+	go func() {
+		hub.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("hub did not stop")
+	}
+}
+
+// TestHubConcurrentClients joins, replays to and removes clients while events are delivered
+// and messages submitted to the hub. The clients present during the whole run must receive
+// every event in the order of its deliverer, and every accepted message must be processed.
+func TestHubConcurrentClients(t *testing.T) {
+	const (
+		stableClients        = 20
+		churnClients         = 20
+		churnRounds          = 50
+		broadcasters         = 4
+		eventsPerBroadcaster = 200
+		senders              = 4
+		messagesPerSender    = 100
+		totalEvents          = broadcasters * eventsPerBroadcaster
+	)
+
+	var processed atomic.Int64
+	hub := NewHub(testRoomID, 16, func(msg *entity.Message) {
+		processed.Add(1)
+	})
+	hub.Start()
+
+	cfg := &ChatConfig{SendBuffSize: totalEvents + churnRounds}
+
+	stable := make([]*Client, stableClients)
+	for i := range stable {
+		stable[i] = NewClient(nil, cfg, testRoomID, entity.ID(i+1))
+		hub.Register(stable[i])
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < churnClients; i++ {
+		wg.Add(1)
+		go func(userID entity.ID) {
+			defer wg.Done()
+			for round := 0; round < churnRounds; round++ {
+				cl := NewClient(nil, cfg, testRoomID, userID)
+				if round%2 == 0 {
+					hub.Register(cl)
+					cl.AddHub(hub)
+				} else {
+					replay := cl.Hold(testRoomID)
+					hub.Register(cl)
+					cl.AddHub(hub)
+					cl.SendReplayed(replay, newTestEvent(testRoomID, entity.ID(round)))
+					cl.Release(replay)
+				}
+				cl.RemoveHub(hub)
+				hub.Unregister(cl)
+				cl.Close()
+			}
+		}(entity.ID(stableClients + i + 1))
+	}
+
+	for b := 0; b < broadcasters; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			for i := 1; i <= eventsPerBroadcaster; i++ {
+				hub.Deliver(newTestEvent(testRoomID, entity.ID(b*eventsPerBroadcaster+i)))
+			}
+		}(b)
+	}
+
+	var accepted atomic.Int64
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < messagesPerSender; i++ {
+				if hub.Submit(&entity.Message{RoomID: testRoomID}) {
+					accepted.Add(1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	stopHub(t, hub)
+
+	if got, want := processed.Load(), accepted.Load(); got != want {
+		t.Fatalf("processed %d messages, accepted %d", got, want)
+	}
+	if got := accepted.Load(); got != senders*messagesPerSender {
+		t.Fatalf("accepted %d messages, want %d", got, senders*messagesPerSender)
+	}
+
+	for _, cl := range stable {
+		if got := len(cl.Message); got != totalEvents {
+			t.Fatalf("client %d received %d events, want %d", cl.UserID, got, totalEvents)
+		}
+		last := make([]entity.ID, broadcasters)
+		for i := 0; i < totalEvents; i++ {
+			ev := <-cl.Message
+			b := (ev.Seq - 1) / eventsPerBroadcaster
+			if ev.Seq <= last[b] {
+				t.Fatalf("client %d received event %d after %d", cl.UserID, ev.Seq, last[b])
+			}
+			last[b] = ev.Seq
+		}
+	}
+
+	// a stopped hub must not block its callers
+	cl := NewClient(nil, cfg, testRoomID, 1)
+	hub.Register(cl)
+	hub.Deliver(newTestEvent(testRoomID, 1))
+	hub.Unregister(cl)
+	if hub.Submit(&entity.Message{RoomID: testRoomID}) {
+		t.Fatal("stopped hub accepted a message")
+	}
+	if got := len(cl.Message); got != 0 {
+		t.Fatalf("stopped hub delivered %d events", got)
+	}
+}
+
+// TestClientHoldRelease replays messages to a client while the live events of some of them
+// and of later messages are delivered. Every message must be received once and in order.
+func TestClientHoldRelease(t *testing.T) {
+	const (
+		lastReplayed = 60
+		firstLive    = 50
+		lastMessage  = 100
+	)
+
+	hub := NewHub(testRoomID, 16, func(msg *entity.Message) {})
+	hub.Start()
+	defer stopHub(t, hub)
+
+	// the live events held until the release must fit into the send buffer
+	cl := NewClient(nil, &ChatConfig{SendBuffSize: lastMessage}, testRoomID, 1)
+	replay := cl.Hold(testRoomID)
+	hub.Register(cl)
+	cl.AddHub(hub)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer cl.Release(replay)
+		for seq := entity.ID(1); seq <= lastReplayed; seq++ {
+			if !cl.SendReplayed(replay, newTestEvent(testRoomID, seq)) {
+				t.Errorf("replayed message %d not sent", seq)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for seq := entity.ID(firstLive); seq <= lastMessage; seq++ {
+			hub.Deliver(newTestEvent(testRoomID, seq))
+		}
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for want := entity.ID(1); want <= lastMessage; want++ {
+		select {
+		case ev := <-cl.Message:
+			if ev.Seq != want {
+				t.Fatalf("received message %d, want %d", ev.Seq, want)
+			}
+		case <-cl.Done():
+			t.Fatal("client closed")
+		case <-timeout:
+			t.Fatalf("message %d not received", want)
+		}
+	}
+	wg.Wait()
+
+	select {
+	case ev := <-cl.Message:
+		t.Fatalf("received message %d twice", ev.Seq)
+	default:
+	}
+}
+
+// TestClientReleaseAfterLeave leaves the room during a replay. The rest of the replay
+// and the live events held meanwhile must not reach the client.
+func TestClientReleaseAfterLeave(t *testing.T) {
+	hub := NewHub(testRoomID, 16, func(msg *entity.Message) {})
+	cl := NewClient(nil, &ChatConfig{SendBuffSize: 16}, testRoomID, 1)
+
+	replay := cl.Hold(testRoomID)
+	cl.AddHub(hub)
+	if !cl.SendReplayed(replay, newTestEvent(testRoomID, 1)) {
+		t.Fatal("replayed message not sent")
+	}
+	cl.Send(newTestEvent(testRoomID, 2))
+
+	cl.RemoveHub(hub)
+	if cl.SendReplayed(replay, newTestEvent(testRoomID, 3)) {
+		t.Fatal("replayed message sent after leaving the room")
+	}
+	cl.Release(replay)
+
+	if got := len(cl.Message); got != 1 {
+		t.Fatalf("client received %d events, want 1", got)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+type PersisterConfig struct {
+	// BatchSize is the maximal number of messages inserted by one statement
+	BatchSize int
+	// FlushInterval is how long a message waits for the batch to fill up
+	FlushInterval time.Duration
+	// QueueSize is the number of messages waiting to be persisted before Persist blocks
+	QueueSize int
+}
+
+// PersistedFunc is called with the persisted message, reporting whether it has been created
+// or sent before with the same client nonce, or with the error which prevented persisting it.
+type PersistedFunc func(message *entity.Message, created bool, err error)
+
+type pendingMessage struct {
+	req       *entity.CreateMessageReq
+	persisted PersistedFunc
+}
+
+// MessagePersister writes the messages of all rooms in batches instead of one insert per message.
+// A single goroutine inserts the batches and calls back in the order the messages were queued,
+// so the messages of a room queued by its hub keep their order, IDs included.
+type MessagePersister struct {
+	messageUseCase use_case.MessageUseCase
+	batchSize      int
+	flushInterval  time.Duration
+
+	queue chan *pendingMessage
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewMessagePersister(c *PersisterConfig, messageUseCase use_case.MessageUseCase) *MessagePersister {
+	return &MessagePersister{
+		messageUseCase: messageUseCase,
+		batchSize:      c.BatchSize,
+		flushInterval:  c.FlushInterval,
+		queue:          make(chan *pendingMessage, c.QueueSize),
+		done:           make(chan struct{}),
+	}
+}
+
+// Start starts the goroutine of the persister. Subsequent calls do nothing.
+func (p *MessagePersister) Start() {
+	p.startOnce.Do(func() {
+		p.wg.Add(1)
+		go p.run()
+	})
+}
+
+// Stop persists the messages already queued and waits for the goroutine of the persister to exit.
+func (p *MessagePersister) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+	})
+	p.wg.Wait()
+}
+
+// Persist queues the message, blocking while the queue is full, and calls persisted once it is written.
+// It returns false if the persister is stopped.
+func (p *MessagePersister) Persist(req *entity.CreateMessageReq, persisted PersistedFunc) bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
+
+	select {
+	case p.queue <- &pendingMessage{req: req, persisted: persisted}:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+func (p *MessagePersister) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*pendingMessage, 0, p.batchSize)
+	for {
+		select {
+		case pm := <-p.queue:
+			batch = append(batch, pm)
+			if len(batch) >= p.batchSize {
+				batch = p.flush(batch)
+			}
+		case <-ticker.C:
+			batch = p.flush(batch)
+		case <-p.done:
+			// messages accepted before the stop are still persisted
+			for {
+				select {
+				case pm := <-p.queue:
+					batch = append(batch, pm)
+					if len(batch) >= p.batchSize {
+						batch = p.flush(batch)
+					}
+				default:
+					p.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush persists the batch and returns it emptied for reuse.
+func (p *MessagePersister) flush(batch []*pendingMessage) []*pendingMessage {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	reqs := make([]*entity.CreateMessageReq, len(batch))
+	for i, pm := range batch {
+		reqs[i] = pm.req
+	}
+
+	res, err := p.messageUseCase.CreateMessageBulk(reqs)
+	if err != nil {
+		// one message failing a constraint must not lose the others, so they are inserted one by one
+		log.Printf("error persisting batch of %d messages, persisting them one by one: %v", len(batch), err)
+		for _, pm := range batch {
+			message, created, err := p.messageUseCase.CreateMessage(pm.req)
+			if err != nil {
+				err = fmt.Errorf("MessagePersister.flush: %w", err)
+			}
+			pm.persisted(message, created, err)
+		}
+	} else {
+		for i, pm := range batch {
+			pm.persisted(res[i].Message, res[i].Created, res[i].Err)
+		}
+	}
+
+	persistBatches.Add(1)
+	persistedMessages.Add(int64(len(batch)))
+
+	for i := range batch {
+		batch[i] = nil
+	}
+	return batch[:0]
+}
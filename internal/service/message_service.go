@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 
 	"chat-server/internal/domain/entity"
@@ -8,26 +9,86 @@ import (
 )
 
 type MessageService struct {
-	repo use_case.MessageStorage
+	repo               use_case.MessageStorage
+	readCursorRepo     use_case.ReadCursorStorage
+	deliveryCursorRepo use_case.DeliveryCursorStorage
+	reactionRepo       use_case.ReactionStorage
+	pinRepo            use_case.PinStorage
 }
 
-func NewMessageService(repo use_case.MessageStorage) use_case.MessageUseCase {
+func NewMessageService(
+	repo use_case.MessageStorage,
+	readCursorRepo use_case.ReadCursorStorage,
+	deliveryCursorRepo use_case.DeliveryCursorStorage,
+	reactionRepo use_case.ReactionStorage,
+	pinRepo use_case.PinStorage,
+) use_case.MessageUseCase {
 	return &MessageService{
-		repo: repo,
+		repo:               repo,
+		readCursorRepo:     readCursorRepo,
+		deliveryCursorRepo: deliveryCursorRepo,
+		reactionRepo:       reactionRepo,
+		pinRepo:            pinRepo,
 	}
 }
 
-func (m *MessageService) CreateMessage(req *entity.CreateMessageReq) (*entity.Message, error) {
+func (m *MessageService) CreateMessage(req *entity.CreateMessageReq) (*entity.Message, bool, error) {
 	message := &entity.Message{
-		SenderID: req.SenderID,
-		RoomID:   req.RoomID,
-		Content:  req.Content,
+		SenderID:    req.SenderID,
+		RoomID:      req.RoomID,
+		Content:     req.Content,
+		ClientNonce: req.ClientNonce,
+		ParentID:    req.ParentID,
 	}
 	msg, err := m.repo.InsertMessage(message)
+	if errors.Is(err, use_case.ErrMessageDuplicate) {
+		msg, err = m.repo.SelectMessageByClientNonce(req.SenderID, req.ClientNonce)
+		if err != nil {
+			return nil, false, fmt.Errorf("MesssageService.CreateMessage: %w", err)
+		}
+		return msg, false, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("MesssageService.CreateMessage: %w", err)
+		return nil, false, fmt.Errorf("MesssageService.CreateMessage: %w", err)
 	}
-	return msg, nil
+	return msg, true, nil
+}
+
+func (m *MessageService) CreateMessageBulk(
+	reqs []*entity.CreateMessageReq,
+) ([]entity.CreateMessageRes, error) {
+	messages := make([]*entity.Message, len(reqs))
+	for i, req := range reqs {
+		messages[i] = &entity.Message{
+			SenderID:    req.SenderID,
+			RoomID:      req.RoomID,
+			Content:     req.Content,
+			ClientNonce: req.ClientNonce,
+			ParentID:    req.ParentID,
+		}
+	}
+	if err := m.repo.InsertMessageBulk(messages); err != nil {
+		return nil, fmt.Errorf("MesssageService.CreateMessageBulk: %w", err)
+	}
+
+	res := make([]entity.CreateMessageRes, len(messages))
+	for i, message := range messages {
+		if message.ID != 0 {
+			res[i] = entity.CreateMessageRes{Message: message, Created: true}
+			continue
+		}
+		msg, err := m.repo.SelectMessageByClientNonce(message.SenderID, message.ClientNonce)
+		if errors.Is(err, use_case.ErrMessageNonceDeleted) {
+			// the other messages of the bulk are inserted already, so only the retry fails
+			res[i] = entity.CreateMessageRes{Err: fmt.Errorf("MesssageService.CreateMessageBulk: %w", err)}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("MesssageService.CreateMessageBulk: %w", err)
+		}
+		res[i] = entity.CreateMessageRes{Message: msg, Created: false}
+	}
+	return res, nil
 }
 
 func (m *MessageService) GetMessageByID(id entity.ID) (*entity.Message, error) {
@@ -44,25 +105,96 @@ func (m *MessageService) EditMessageContent(req *entity.EditMessageReq) (*entity
 		return nil, fmt.Errorf("MesssageService.EditMessageContent: %w", err)
 	}
 	message.Content = req.Content
-	err = m.repo.UpdateMessage(message)
+	err = m.repo.UpdateMessageContent(message)
 	if err != nil {
 		return nil, fmt.Errorf("MesssageService.EditMessageContent: %w", err)
 	}
 	return message, nil
 }
 
-func (m *MessageService) MarkReadMessageStatusByID(id entity.ID) error {
+func (m *MessageService) GetMessageRevisions(id entity.ID) ([]entity.MessageRevision, error) {
+	revisions, err := m.repo.SelectRevisionBulkByMessageID(id)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetMessageRevisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// MarkReadMessageStatusByID moves the read cursor of the user in the message room up to the message.
+// The global status of the messages is kept as "read by at least one recipient".
+// A read message is delivered as well, so the delivery cursor is moved too.
+func (m *MessageService) MarkReadMessageStatusByID(
+	userID entity.ID,
+	id entity.ID,
+) (*entity.ReadCursor, error) {
 	message, err := m.repo.SelectMessage(id)
 	if err != nil {
-		return fmt.Errorf("MesssageService.MarkReadMessageStatusByID: %w", err)
+		return nil, fmt.Errorf("MesssageService.MarkReadMessageStatusByID: %w", err)
+	}
+	cursor, previousID, err := m.readCursorRepo.UpsertReadCursor(&entity.ReadCursor{
+		RoomID:            message.RoomID,
+		UserID:            userID,
+		LastReadMessageID: message.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.MarkReadMessageStatusByID: %w", err)
+	}
+	if cursor.LastReadMessageID > previousID {
+		err := m.repo.MarkReadMessageBulk(message.RoomID, previousID, cursor.LastReadMessageID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("MesssageService.MarkReadMessageStatusByID: %w", err)
+		}
+	}
+	_, _, err = m.deliveryCursorRepo.UpsertDeliveryCursor(&entity.DeliveryCursor{
+		RoomID:                 message.RoomID,
+		UserID:                 userID,
+		LastDeliveredMessageID: message.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.MarkReadMessageStatusByID: %w", err)
 	}
-	message.Status = "read"
-	if err := m.repo.UpdateMessage(message); err != nil {
-		return fmt.Errorf("MesssageService.MarkReadMessageStatusByID: err")
+	return cursor, nil
+}
+
+// MarkDeliveredMessageStatus moves the delivery cursor of the user in the room up to the message.
+// The global status of the messages is kept as "delivered to at least one recipient" until they are read.
+func (m *MessageService) MarkDeliveredMessageStatus(
+	userID entity.ID,
+	roomID entity.ID,
+	id entity.ID,
+) (*entity.DeliveryCursor, error) {
+	cursor, previousID, err := m.deliveryCursorRepo.UpsertDeliveryCursor(&entity.DeliveryCursor{
+		RoomID:                 roomID,
+		UserID:                 userID,
+		LastDeliveredMessageID: id,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.MarkDeliveredMessageStatus: %w", err)
+	}
+	if cursor.LastDeliveredMessageID > previousID {
+		err := m.repo.MarkDeliveredMessageBulk(roomID, previousID, cursor.LastDeliveredMessageID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("MesssageService.MarkDeliveredMessageStatus: %w", err)
+		}
+	}
+	return cursor, nil
+}
+
+func (m *MessageService) MarkDeliveredMessageBulk(userID entity.ID, roomID entity.ID, ids []entity.ID) error {
+	if err := m.repo.MarkDeliveredMessageBulkByID(roomID, ids, userID); err != nil {
+		return fmt.Errorf("MesssageService.MarkDeliveredMessageBulk: %w", err)
 	}
 	return nil
 }
 
+func (m *MessageService) GetReceiptCounts(id entity.ID) (*entity.ReceiptCounts, error) {
+	counts, err := m.repo.SelectReceiptCounts(id)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetReceiptCounts: %w", err)
+	}
+	return counts, nil
+}
+
 func (m *MessageService) RemoveMessageByID(id entity.ID) error {
 	if err := m.repo.SoftDeleteMessageByID(id); err != nil {
 		return fmt.Errorf("MesssageService.RemoveMessageByID: %w", err)
@@ -70,16 +202,316 @@ func (m *MessageService) RemoveMessageByID(id entity.ID) error {
 	return nil
 }
 
+// GetMessageBulkPaginate selects one message more than the page holds to find out whether the history goes on.
 func (m *MessageService) GetMessageBulkPaginate(
 	req *entity.GetMessageBulkPaginateReq,
-) ([]entity.Message, error) {
-	messageBulk, err := m.repo.SelectMessageBulkPaginateReverse(req.RoomID, req.PerPage, req.Page)
+) (*entity.MessagePage, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = entity.DefaultMessagePageLimit
+	}
+	beforeID, err := req.Before.MessageID()
 	if err != nil {
 		return nil, fmt.Errorf("MesssageService.GetMessageBulkPaginate: %w", err)
 	}
+	afterID, err := req.After.MessageID()
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetMessageBulkPaginate: %w", err)
+	}
+
+	var messageBulk []entity.Message
+	var hasOlder, hasNewer bool
+	if afterID != 0 {
+		messageBulk, err = m.repo.SelectMessageBulkAfterID(req.RoomID, afterID, limit+1)
+		if err != nil {
+			return nil, fmt.Errorf("MesssageService.GetMessageBulkPaginate: %w", err)
+		}
+		if uint(len(messageBulk)) > limit {
+			messageBulk = messageBulk[:limit]
+			hasNewer = true
+		}
+		// the messages after the cursor are selected the oldest first
+		for i, j := 0, len(messageBulk)-1; i < j; i, j = i+1, j-1 {
+			messageBulk[i], messageBulk[j] = messageBulk[j], messageBulk[i]
+		}
+		// the message of the cursor and the ones before it may have been deleted since the cursor was handed out
+		if len(messageBulk) != 0 {
+			older, err := m.repo.SelectMessageBulkBeforeID(req.RoomID, messageBulk[len(messageBulk)-1].ID, 1)
+			if err != nil {
+				return nil, fmt.Errorf("MesssageService.GetMessageBulkPaginate: %w", err)
+			}
+			hasOlder = len(older) != 0
+		}
+	} else {
+		messageBulk, err = m.repo.SelectMessageBulkBeforeID(req.RoomID, beforeID, limit+1)
+		if err != nil {
+			return nil, fmt.Errorf("MesssageService.GetMessageBulkPaginate: %w", err)
+		}
+		if uint(len(messageBulk)) > limit {
+			messageBulk = messageBulk[:limit]
+			hasOlder = true
+		}
+		hasNewer = beforeID != 0
+	}
+
+	cursors, err := m.readCursorRepo.SelectReadCursorBulkByRoomID(req.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetMessageBulkPaginate: %w", err)
+	}
+	deliveryCursors, err := m.deliveryCursorRepo.SelectDeliveryCursorBulkByRoomID(req.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetMessageBulkPaginate: %w", err)
+	}
+	summaries, err := m.selectThreadSummaries(messageBulk)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetMessageBulkPaginate: %w", err)
+	}
+	reactions, err := m.selectReactions(messageBulk, req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetMessageBulkPaginate: %w", err)
+	}
+	for i := range messageBulk {
+		messageBulk[i].SetReadBy(cursors)
+		messageBulk[i].SetDeliveredTo(deliveryCursors)
+		messageBulk[i].SetThreadSummary(summaries)
+		messageBulk[i].SetReactions(reactions)
+	}
+
+	page := &entity.MessagePage{Messages: messageBulk}
+	if page.Messages == nil {
+		page.Messages = []entity.Message{}
+	}
+	if len(messageBulk) != 0 {
+		if hasOlder {
+			page.NextCursor = entity.NewMessageCursor(messageBulk[len(messageBulk)-1].ID)
+		}
+		if hasNewer {
+			page.PrevCursor = entity.NewMessageCursor(messageBulk[0].ID)
+		}
+	}
+	return page, nil
+}
+
+func (m *MessageService) GetMessageBulkAfterID(
+	roomID entity.ID,
+	afterID entity.ID,
+	limit uint,
+) ([]entity.Message, error) {
+	messageBulk, err := m.repo.SelectMessageBulkAfterID(roomID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetMessageBulkAfterID: %w", err)
+	}
 	return messageBulk, nil
 }
 
+func (m *MessageService) GetThreadParent(roomID entity.ID, id entity.ID) (*entity.Message, error) {
+	parent, err := m.repo.SelectMessage(id)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetThreadParent: %w", err)
+	}
+	if parent.ParentID != 0 {
+		parent, err = m.repo.SelectMessage(parent.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("MesssageService.GetThreadParent: %w", err)
+		}
+	}
+	if parent.RoomID != roomID {
+		return nil, fmt.Errorf("MesssageService.GetThreadParent: %w", entity.ErrThreadParentRoom)
+	}
+	return parent, nil
+}
+
+// GetThread returns the parent message with the summary of its thread and a page of the replies.
+// The thread of a reply is the thread it belongs to.
+func (m *MessageService) GetThread(req *entity.GetThreadReq) (*entity.Thread, error) {
+	parent, err := m.repo.SelectMessage(req.ParentID)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetThread: %w", err)
+	}
+	if parent.ParentID != 0 {
+		parent, err = m.repo.SelectMessage(parent.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("MesssageService.GetThread: %w", err)
+		}
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = entity.DefaultMessagePageLimit
+	}
+	afterID, err := req.After.MessageID()
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetThread: %w", err)
+	}
+	replies, err := m.repo.SelectThreadReplyBulkAfterID(parent.ID, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetThread: %w", err)
+	}
+	hasMore := uint(len(replies)) > limit
+	if hasMore {
+		replies = replies[:limit]
+	}
+
+	cursors, err := m.readCursorRepo.SelectReadCursorBulkByRoomID(parent.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetThread: %w", err)
+	}
+	deliveryCursors, err := m.deliveryCursorRepo.SelectDeliveryCursorBulkByRoomID(parent.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetThread: %w", err)
+	}
+	summaries, err := m.selectThreadSummaries([]entity.Message{*parent})
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetThread: %w", err)
+	}
+	reactions, err := m.selectReactions(append([]entity.Message{*parent}, replies...), req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetThread: %w", err)
+	}
+	parent.SetReadBy(cursors)
+	parent.SetDeliveredTo(deliveryCursors)
+	parent.SetThreadSummary(summaries)
+	parent.SetReactions(reactions)
+	for i := range replies {
+		replies[i].SetReadBy(cursors)
+		replies[i].SetDeliveredTo(deliveryCursors)
+		replies[i].SetReactions(reactions)
+	}
+	thread := &entity.Thread{Parent: parent, Replies: replies}
+	if thread.Replies == nil {
+		thread.Replies = []entity.Message{}
+	}
+	if hasMore {
+		thread.NextCursor = entity.NewMessageCursor(replies[len(replies)-1].ID)
+	}
+	return thread, nil
+}
+
+// selectThreadSummaries summarizes the threads started by the messages by the ID of the parent message.
+func (m *MessageService) selectThreadSummaries(messages []entity.Message) (map[entity.ID]entity.ThreadSummary, error) {
+	var parentIDs []entity.ID
+	for _, message := range messages {
+		// a reply never starts a thread
+		if message.ParentID == 0 {
+			parentIDs = append(parentIDs, message.ID)
+		}
+	}
+	summaryBulk, err := m.repo.SelectThreadSummaryBulk(parentIDs)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.selectThreadSummaries: %w", err)
+	}
+	summaries := make(map[entity.ID]entity.ThreadSummary, len(summaryBulk))
+	for _, summary := range summaryBulk {
+		summaries[summary.ParentID] = summary
+	}
+	return summaries, nil
+}
+
+// selectReactions counts the reactions of the messages by the message ID, flagging the ones of the user.
+func (m *MessageService) selectReactions(
+	messages []entity.Message,
+	userID entity.ID,
+) (map[entity.ID][]entity.ReactionCount, error) {
+	messageIDs := make([]entity.ID, len(messages))
+	for i, message := range messages {
+		messageIDs[i] = message.ID
+	}
+	counts, err := m.reactionRepo.SelectReactionCountBulk(messageIDs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.selectReactions: %w", err)
+	}
+	reactions := make(map[entity.ID][]entity.ReactionCount)
+	for _, count := range counts {
+		reactions[count.MessageID] = append(reactions[count.MessageID], count.ReactionCount)
+	}
+	return reactions, nil
+}
+
+func (m *MessageService) AddReaction(req *entity.ReactionReq) (*entity.ReactionChange, bool, error) {
+	message, err := m.repo.SelectMessage(req.MessageID)
+	if err != nil {
+		return nil, false, fmt.Errorf("MesssageService.AddReaction: %w", err)
+	}
+	added, err := m.reactionRepo.InsertReaction(message.ID, req.UserID, req.Emoji)
+	if err != nil {
+		return nil, false, fmt.Errorf("MesssageService.AddReaction: %w", err)
+	}
+	change, err := m.reactionChange(message, req)
+	if err != nil {
+		return nil, false, fmt.Errorf("MesssageService.AddReaction: %w", err)
+	}
+	return change, added, nil
+}
+
+func (m *MessageService) RemoveReaction(req *entity.ReactionReq) (*entity.ReactionChange, bool, error) {
+	message, err := m.repo.SelectMessage(req.MessageID)
+	if err != nil {
+		return nil, false, fmt.Errorf("MesssageService.RemoveReaction: %w", err)
+	}
+	removed, err := m.reactionRepo.DeleteReaction(message.ID, req.UserID, req.Emoji)
+	if err != nil {
+		return nil, false, fmt.Errorf("MesssageService.RemoveReaction: %w", err)
+	}
+	change, err := m.reactionChange(message, req)
+	if err != nil {
+		return nil, false, fmt.Errorf("MesssageService.RemoveReaction: %w", err)
+	}
+	return change, removed, nil
+}
+
+func (m *MessageService) reactionChange(
+	message *entity.Message,
+	req *entity.ReactionReq,
+) (*entity.ReactionChange, error) {
+	count, err := m.reactionRepo.SelectReactionCount(message.ID, req.Emoji)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.reactionChange: %w", err)
+	}
+	return &entity.ReactionChange{
+		MessageID: message.ID,
+		RoomID:    message.RoomID,
+		UserID:    req.UserID,
+		Emoji:     req.Emoji,
+		Count:     count,
+	}, nil
+}
+
+func (m *MessageService) PinMessage(req *entity.PinReq) (*entity.Pin, bool, error) {
+	message, err := m.repo.SelectMessage(req.MessageID)
+	if err != nil {
+		return nil, false, fmt.Errorf("MesssageService.PinMessage: %w", err)
+	}
+	if message.RoomID != req.RoomID {
+		return nil, false, fmt.Errorf("MesssageService.PinMessage: %w", entity.ErrPinMessageRoom)
+	}
+	pin, pinned, err := m.pinRepo.InsertPin(&entity.Pin{
+		RoomID:    message.RoomID,
+		MessageID: message.ID,
+		PinnedBy:  req.UserID,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("MesssageService.PinMessage: %w", err)
+	}
+	pin.Message = message
+	return pin, pinned, nil
+}
+
+func (m *MessageService) UnpinMessage(req *entity.PinReq) (*entity.Pin, bool, error) {
+	unpinned, err := m.pinRepo.DeletePin(req.RoomID, req.MessageID)
+	if err != nil {
+		return nil, false, fmt.Errorf("MesssageService.UnpinMessage: %w", err)
+	}
+	return &entity.Pin{RoomID: req.RoomID, MessageID: req.MessageID}, unpinned, nil
+}
+
+func (m *MessageService) GetPinBulkByRoomID(roomID entity.ID) ([]entity.Pin, error) {
+	pins, err := m.pinRepo.SelectPinBulkByRoomID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("MesssageService.GetPinBulkByRoomID: %w", err)
+	}
+	return pins, nil
+}
+
 func (m *MessageService) IsMessageOwner(userID entity.ID, messageID entity.ID) (bool, error) {
 	msg, err := m.repo.SelectMessage(messageID)
 	if err != nil {
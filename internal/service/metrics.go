@@ -0,0 +1,13 @@
+package service
+
+import "expvar"
+
+// Metrics are published in the expvar format at /debug/vars.
+var (
+	slowConsumerDisconnects = expvar.NewInt("chat_slow_consumer_disconnects")
+	rateLimitedFrames       = expvar.NewInt("chat_rate_limited_frames")
+	rateLimitDisconnects    = expvar.NewInt("chat_rate_limit_disconnects")
+	rateLimitErrors         = expvar.NewInt("chat_rate_limit_errors")
+	persistBatches          = expvar.NewInt("chat_persist_batches")
+	persistedMessages       = expvar.NewInt("chat_persisted_messages")
+)
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+var errTestInsert = errors.New("insert failed")
+
+// fakeMessageUseCase records the inserts of the persister. The methods it does not override
+// are not used by the persister and panic on the nil embedded interface.
+type fakeMessageUseCase struct {
+	use_case.MessageUseCase
+
+	// bulkErr fails every batch, failingContent fails the single insert of the message with that content
+	bulkErr        error
+	failingContent entity.NonEmptyString
+
+	mu      sync.Mutex
+	lastID  entity.ID
+	batches [][]*entity.CreateMessageReq
+	singles []*entity.CreateMessageReq
+}
+
+func (f *fakeMessageUseCase) CreateMessageBulk(reqs []*entity.CreateMessageReq) ([]entity.CreateMessageRes, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.batches = append(f.batches, reqs)
+	if f.bulkErr != nil {
+		return nil, f.bulkErr
+	}
+	res := make([]entity.CreateMessageRes, len(reqs))
+	for i, req := range reqs {
+		res[i] = entity.CreateMessageRes{Message: f.newMessage(req), Created: true}
+	}
+	return res, nil
+}
+
+func (f *fakeMessageUseCase) CreateMessage(req *entity.CreateMessageReq) (*entity.Message, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.singles = append(f.singles, req)
+	if req.Content == f.failingContent {
+		return nil, false, errTestInsert
+	}
+	return f.newMessage(req), true, nil
+}
+
+func (f *fakeMessageUseCase) newMessage(req *entity.CreateMessageReq) *entity.Message {
+	f.lastID++
+	return &entity.Message{ID: f.lastID, RoomID: req.RoomID, SenderID: req.SenderID, Content: req.Content}
+}
+
+func (f *fakeMessageUseCase) batchSizes() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sizes := make([]int, len(f.batches))
+	for i, batch := range f.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+type persistResult struct {
+	message *entity.Message
+	created bool
+	err     error
+}
+
+// persistMessages queues n messages and returns the channel receiving their results in the order of the callbacks.
+func persistMessages(t *testing.T, p *MessagePersister, n int) <-chan persistResult {
+	t.Helper()
+
+	results := make(chan persistResult, n)
+	for i := 0; i < n; i++ {
+		req := &entity.CreateMessageReq{
+			SenderID: 1,
+			RoomID:   testRoomID,
+			Content:  entity.NonEmptyString(string(rune('a' + i))),
+		}
+		ok := p.Persist(req, func(message *entity.Message, created bool, err error) {
+			results <- persistResult{message: message, created: created, err: err}
+		})
+		if !ok {
+			t.Fatalf("message %d not queued", i)
+		}
+	}
+	return results
+}
+
+// receiveResults waits for n results, failing the test if they do not arrive in time.
+func receiveResults(t *testing.T, results <-chan persistResult, n int) []persistResult {
+	t.Helper()
+
+	received := make([]persistResult, 0, n)
+	timeout := time.After(5 * time.Second)
+	for len(received) < n {
+		select {
+		case res := <-results:
+			received = append(received, res)
+		case <-timeout:
+			t.Fatalf("received %d results, want %d", len(received), n)
+		}
+	}
+	return received
+}
+
+func TestMessagePersisterFlush(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        PersisterConfig
+		messages   int
+		wantSizes  []int
+		stopBefore bool
+	}{
+		{
+			name:      "by batch size",
+			cfg:       PersisterConfig{BatchSize: 3, FlushInterval: time.Hour, QueueSize: 16},
+			messages:  6,
+			wantSizes: []int{3, 3},
+		},
+		{
+			name:      "by interval",
+			cfg:       PersisterConfig{BatchSize: 100, FlushInterval: 10 * time.Millisecond, QueueSize: 16},
+			messages:  1,
+			wantSizes: []int{1},
+		},
+		{
+			name:       "on stop",
+			cfg:        PersisterConfig{BatchSize: 4, FlushInterval: time.Hour, QueueSize: 16},
+			messages:   10,
+			wantSizes:  []int{4, 4, 2},
+			stopBefore: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := &fakeMessageUseCase{}
+			p := NewMessagePersister(&tt.cfg, useCase)
+			if !tt.stopBefore {
+				p.Start()
+				defer p.Stop()
+			}
+
+			results := persistMessages(t, p, tt.messages)
+			if tt.stopBefore {
+				// the queued messages are persisted before Stop returns
+				p.Start()
+				p.Stop()
+				if got := len(results); got != tt.messages {
+					t.Fatalf("persisted %d messages before the stop, want %d", got, tt.messages)
+				}
+			}
+
+			received := receiveResults(t, results, tt.messages)
+			for i, res := range received {
+				if res.err != nil || !res.created {
+					t.Fatalf("message %d: created %v, error %v", i, res.created, res.err)
+				}
+				if want := entity.ID(i + 1); res.message.ID != want {
+					t.Fatalf("message %d has ID %d, want %d", i, res.message.ID, want)
+				}
+			}
+
+			sizes := useCase.batchSizes()
+			if len(sizes) != len(tt.wantSizes) {
+				t.Fatalf("batch sizes %v, want %v", sizes, tt.wantSizes)
+			}
+			for i := range sizes {
+				if sizes[i] != tt.wantSizes[i] {
+					t.Fatalf("batch sizes %v, want %v", sizes, tt.wantSizes)
+				}
+			}
+		})
+	}
+}
+
+// TestMessagePersisterFallback fails the batch insert. Its messages must be inserted one by one,
+// and a failing one must not prevent the others from being persisted.
+func TestMessagePersisterFallback(t *testing.T) {
+	const messages = 3
+
+	useCase := &fakeMessageUseCase{bulkErr: errTestInsert, failingContent: "b"}
+	p := NewMessagePersister(&PersisterConfig{BatchSize: messages, FlushInterval: time.Hour, QueueSize: 16}, useCase)
+	p.Start()
+	defer p.Stop()
+
+	received := receiveResults(t, persistMessages(t, p, messages), messages)
+
+	if got := len(useCase.singles); got != messages {
+		t.Fatalf("inserted %d messages one by one, want %d", got, messages)
+	}
+	for i, res := range received {
+		content := entity.NonEmptyString(string(rune('a' + i)))
+		if content == useCase.failingContent {
+			if !errors.Is(res.err, errTestInsert) {
+				t.Fatalf("message %q: error %v, want %v", content, res.err, errTestInsert)
+			}
+			continue
+		}
+		if res.err != nil || !res.created || res.message.Content != content {
+			t.Fatalf("message %q: persisted %+v", content, res)
+		}
+	}
+}
+
+func TestMessagePersisterStopped(t *testing.T) {
+	p := NewMessagePersister(&PersisterConfig{BatchSize: 1, FlushInterval: time.Hour, QueueSize: 1}, &fakeMessageUseCase{})
+	p.Start()
+	p.Stop()
+
+	req := &entity.CreateMessageReq{SenderID: 1, RoomID: testRoomID, Content: "a"}
+	if p.Persist(req, func(*entity.Message, bool, error) {}) {
+		t.Fatal("stopped persister accepted a message")
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+type PresenceConfig struct {
+	// TTL is how long a connection is considered live without being refreshed
+	TTL time.Duration
+}
+
+// RefreshInterval returns how often live connections should be refreshed to not expire.
+func (c *PresenceConfig) RefreshInterval() time.Duration {
+	return c.TTL / 3
+}
+
+type presenceService struct {
+	repo use_case.PresenceStorage
+	ttl  time.Duration
+}
+
+func NewPresenceService(c *PresenceConfig, repo use_case.PresenceStorage) use_case.PresenceUseCase {
+	return &presenceService{
+		repo: repo,
+		ttl:  c.TTL,
+	}
+}
+
+func (p *presenceService) Connect(
+	ctx context.Context,
+	userID entity.ID,
+	connID string,
+) (*entity.Presence, bool, error) {
+	count, err := p.repo.AddConnection(ctx, userID, connID, p.ttl)
+	if err != nil {
+		return nil, false, fmt.Errorf("presenceService.Connect: %w", err)
+	}
+	if count > 1 {
+		presence, err := p.GetPresence(ctx, userID)
+		if err != nil {
+			return nil, false, fmt.Errorf("presenceService.Connect: %w", err)
+		}
+		return presence, false, nil
+	}
+
+	if _, err := p.repo.SetStatus(ctx, userID, entity.PresenceOnline, p.ttl); err != nil {
+		return nil, false, fmt.Errorf("presenceService.Connect: %w", err)
+	}
+	return &entity.Presence{UserID: userID, Status: entity.PresenceOnline}, true, nil
+}
+
+func (p *presenceService) Disconnect(
+	ctx context.Context,
+	userID entity.ID,
+	connID string,
+) (*entity.Presence, bool, error) {
+	count, err := p.repo.RemoveConnection(ctx, userID, connID)
+	if err != nil {
+		return nil, false, fmt.Errorf("presenceService.Disconnect: %w", err)
+	}
+	if count > 0 {
+		presence, err := p.GetPresence(ctx, userID)
+		if err != nil {
+			return nil, false, fmt.Errorf("presenceService.Disconnect: %w", err)
+		}
+		return presence, false, nil
+	}
+
+	if err := p.repo.DeleteStatus(ctx, userID); err != nil {
+		return nil, false, fmt.Errorf("presenceService.Disconnect: %w", err)
+	}
+	return &entity.Presence{UserID: userID, Status: entity.PresenceOffline}, true, nil
+}
+
+func (p *presenceService) Refresh(ctx context.Context, userID entity.ID, connID string) error {
+	if err := p.repo.RefreshConnection(ctx, userID, connID, p.ttl); err != nil {
+		return fmt.Errorf("presenceService.Refresh: %w", err)
+	}
+	return nil
+}
+
+func (p *presenceService) SetStatus(
+	ctx context.Context,
+	userID entity.ID,
+	status entity.PresenceStatus,
+) (*entity.Presence, bool, error) {
+	prev, err := p.repo.SetStatus(ctx, userID, status, p.ttl)
+	if err != nil {
+		return nil, false, fmt.Errorf("presenceService.SetStatus: %w", err)
+	}
+	return &entity.Presence{UserID: userID, Status: status}, prev != status, nil
+}
+
+func (p *presenceService) GetPresence(
+	ctx context.Context,
+	userID entity.ID,
+) (*entity.Presence, error) {
+	count, err := p.repo.CountConnections(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("presenceService.GetPresence: %w", err)
+	}
+	if count == 0 {
+		return &entity.Presence{UserID: userID, Status: entity.PresenceOffline}, nil
+	}
+
+	status, err := p.repo.GetStatus(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("presenceService.GetPresence: %w", err)
+	}
+	if status == "" {
+		status = entity.PresenceOnline
+	}
+	return &entity.Presence{UserID: userID, Status: status}, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+type RateLimitConfig struct {
+	// User limits the messages of a user in all rooms
+	User entity.RateLimit
+	// Room limits the messages of a user in one room unless the room has its own limit
+	Room entity.RateLimit
+	// Rooms overrides the limit of a user in the rooms with the given IDs
+	Rooms map[entity.ID]entity.RateLimit
+	// Frame limits the frames other than messages of one connection, it is applied in memory
+	Frame entity.RateLimit
+	// MaxViolations is how many rejected frames in a row a client may send before it is disconnected
+	MaxViolations int
+	// FailOpen allows the messages while Redis is unavailable, otherwise they are rejected
+	FailOpen bool
+}
+
+type rateLimitService struct {
+	repo use_case.RateLimitStorage
+	cfg  *RateLimitConfig
+}
+
+func NewRateLimitService(c *RateLimitConfig, repo use_case.RateLimitStorage) use_case.RateLimitUseCase {
+	return &rateLimitService{
+		repo: repo,
+		cfg:  c,
+	}
+}
+
+func (r *rateLimitService) AllowMessage(ctx context.Context, userID entity.ID, roomID entity.ID) (bool, error) {
+	roomLimit, ok := r.cfg.Rooms[roomID]
+	if !ok {
+		roomLimit = r.cfg.Room
+	}
+	allowed, err := r.repo.TakeMessageToken(ctx, userID, roomID, r.cfg.User, roomLimit)
+	if err != nil {
+		rateLimitErrors.Add(1)
+		if r.cfg.FailOpen {
+			log.Printf("error checking rate limit, message allowed: %v", err)
+			return true, nil
+		}
+		return false, fmt.Errorf("rateLimitService.AllowMessage: %w", err)
+	}
+	return allowed, nil
+}
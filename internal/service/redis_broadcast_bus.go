@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+const roomChannelPrefix = "chat:room:"
+
+// busMessage is the wire form of an event published to Redis.
+type busMessage struct {
+	Version      int              `json:"v"`
+	Type         entity.EventType `json:"type"`
+	ID           string           `json:"id,omitempty"`
+	Seq          entity.ID        `json:"seq,omitempty"`
+	Payload      json.RawMessage  `json:"payload,omitempty"`
+	ExceptUserID entity.ID        `json:"except_user_id,omitempty"`
+	ToUserID     entity.ID        `json:"to_user_id,omitempty"`
+	SenderID     entity.ID        `json:"sender_id,omitempty"`
+}
+
+// redisBroadcastBus publishes events to a Redis channel per room. Every instance subscribes
+// to the channels of the rooms it has local clients in, its own publications included.
+type redisBroadcastBus struct {
+	redis  *redis.Client
+	pubsub *redis.PubSub
+
+	mu   sync.RWMutex
+	subs map[entity.ID]map[*busSubscription]struct{}
+}
+
+func NewRedisBroadcastBus(redisClient *redis.Client) use_case.BroadcastBus {
+	b := &redisBroadcastBus{
+		redis:  redisClient,
+		pubsub: redisClient.Subscribe(context.Background()),
+		subs:   make(map[entity.ID]map[*busSubscription]struct{}),
+	}
+	go b.receive()
+	return b
+}
+
+func roomChannel(roomID entity.ID) string {
+	return roomChannelPrefix + strconv.FormatUint(uint64(roomID), 10)
+}
+
+func (b *redisBroadcastBus) Publish(ctx context.Context, roomID entity.ID, ev *entity.Event) error {
+	payload, err := json.Marshal(ev.Payload)
+	if err != nil {
+		return fmt.Errorf("redisBroadcastBus.Publish: %w", err)
+	}
+	data, err := json.Marshal(&busMessage{
+		Version:      ev.Version,
+		Type:         ev.Type,
+		ID:           ev.ID,
+		Seq:          ev.Seq,
+		Payload:      payload,
+		ExceptUserID: ev.ExceptUserID,
+		ToUserID:     ev.ToUserID,
+		SenderID:     ev.SenderID,
+	})
+	if err != nil {
+		return fmt.Errorf("redisBroadcastBus.Publish: %w", err)
+	}
+	if err := b.redis.Publish(ctx, roomChannel(roomID), data).Err(); err != nil {
+		return fmt.Errorf("redisBroadcastBus.Publish: %w", err)
+	}
+	return nil
+}
+
+func (b *redisBroadcastBus) Subscribe(
+	ctx context.Context,
+	roomID entity.ID,
+	handler func(ev *entity.Event),
+) (func(), error) {
+	sub := &busSubscription{handler: handler}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[roomID]; !ok {
+		if err := b.pubsub.Subscribe(ctx, roomChannel(roomID)); err != nil {
+			return nil, fmt.Errorf("redisBroadcastBus.Subscribe: %w", err)
+		}
+		b.subs[roomID] = make(map[*busSubscription]struct{})
+	}
+	b.subs[roomID][sub] = struct{}{}
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[roomID], sub)
+		if len(b.subs[roomID]) > 0 {
+			return
+		}
+		delete(b.subs, roomID)
+		if err := b.pubsub.Unsubscribe(context.Background(), roomChannel(roomID)); err != nil {
+			log.Printf("error unsubscribing from room channel: %v", err)
+		}
+	}, nil
+}
+
+func (b *redisBroadcastBus) Close() error {
+	if err := b.pubsub.Close(); err != nil {
+		return fmt.Errorf("redisBroadcastBus.Close: %w", err)
+	}
+	return nil
+}
+
+// receive dispatches the messages of the subscribed channels to the local handlers
+// until the bus is closed.
+func (b *redisBroadcastBus) receive() {
+	for msg := range b.pubsub.Channel() {
+		roomIDInt, err := strconv.ParseUint(strings.TrimPrefix(msg.Channel, roomChannelPrefix), 10, 0)
+		if err != nil {
+			log.Printf("error parsing room channel %q: %v", msg.Channel, err)
+			continue
+		}
+		roomID := entity.ID(roomIDInt)
+
+		var m busMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+			log.Printf("error decoding room event: %v", err)
+			continue
+		}
+		ev := &entity.Event{
+			Version:      m.Version,
+			Type:         m.Type,
+			ID:           m.ID,
+			RoomID:       roomID,
+			Seq:          m.Seq,
+			Payload:      m.Payload,
+			ExceptUserID: m.ExceptUserID,
+			ToUserID:     m.ToUserID,
+			SenderID:     m.SenderID,
+		}
+
+		b.mu.RLock()
+		handlers := make([]func(ev *entity.Event), 0, len(b.subs[roomID]))
+		for sub := range b.subs[roomID] {
+			handlers = append(handlers, sub.handler)
+		}
+		b.mu.RUnlock()
+
+		for _, handler := range handlers {
+			handler(ev)
+		}
+	}
+}
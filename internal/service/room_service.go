@@ -37,9 +37,10 @@ func (r *roomService) CreateRoom(req *entity.CreateRoomReq) (*entity.CreateRoomR
 	}
 
 	res := entity.CreateRoomRes{
-		ID:      newRoom.ID,
-		OwnerID: newRoom.OwnerID,
-		Name:    newRoom.Name,
+		ID:             newRoom.ID,
+		OwnerID:        newRoom.OwnerID,
+		Name:           newRoom.Name,
+		AllowEphemeral: newRoom.AllowEphemeral,
 	}
 	return &res, nil
 }
@@ -58,22 +59,37 @@ func (r *roomService) GetRoomInfoByID(id entity.ID) (*entity.Room, error) {
 }
 
 func (r *roomService) EditRoomInfo(req *entity.EditRoomReq) (*entity.EditRoomRes, error) {
-	room := entity.Room{
-		ID:   req.ID,
-		Name: req.Name,
+	room, err := r.roomRepo.SelectRoomByID(req.ID)
+	if err != nil {
+		return nil, fmt.Errorf("roomService.EditRoomInfo: %w", err)
+	}
+	if req.Name != "" {
+		room.Name = req.Name
 	}
-	err := r.roomRepo.UpdateRoom(&room)
+	if req.AllowEphemeral != nil {
+		room.AllowEphemeral = *req.AllowEphemeral
+	}
+	err = r.roomRepo.UpdateRoom(room)
 	if err != nil {
 		return nil, fmt.Errorf("roomService.EditRoomInfo: %w", err)
 	}
 
 	res := entity.EditRoomRes{
-		ID:   room.ID,
-		Name: room.Name,
+		ID:             room.ID,
+		Name:           room.Name,
+		AllowEphemeral: room.AllowEphemeral,
 	}
 	return &res, nil
 }
 
+func (r *roomService) AllowsEphemeral(id entity.ID) (bool, error) {
+	room, err := r.roomRepo.SelectRoomByID(id)
+	if err != nil {
+		return false, fmt.Errorf("roomService.AllowsEphemeral: %w", err)
+	}
+	return room.AllowEphemeral, nil
+}
+
 func (r *roomService) RemoveRoomByID(id entity.ID) error {
 	if err := r.roomRepo.DeleteRoom(id); err != nil {
 		return fmt.Errorf("roomService.RemoveRoomByID: %w", err)
@@ -121,3 +137,40 @@ func (r *roomService) AddMemberToRoom(roomID entity.ID, userID entity.ID) (*enti
 	}
 	return m, nil
 }
+
+func (r *roomService) GetRoomIDsByUserID(userID entity.ID) ([]entity.ID, error) {
+	members, err := r.memberRepo.SelectMemberBulkByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("roomService.GetRoomIDsByUserID: %w", err)
+	}
+	roomIDs := make([]entity.ID, 0, len(members))
+	for _, member := range members {
+		roomIDs = append(roomIDs, member.RoomID)
+	}
+	return roomIDs, nil
+}
+
+func (r *roomService) ShareRoom(userID entity.ID, otherUserID entity.ID) (bool, error) {
+	if userID == otherUserID {
+		return true, nil
+	}
+	roomIDs, err := r.GetRoomIDsByUserID(userID)
+	if err != nil {
+		return false, fmt.Errorf("roomService.ShareRoom: %w", err)
+	}
+	otherRoomIDs, err := r.GetRoomIDsByUserID(otherUserID)
+	if err != nil {
+		return false, fmt.Errorf("roomService.ShareRoom: %w", err)
+	}
+
+	rooms := make(map[entity.ID]struct{}, len(roomIDs))
+	for _, roomID := range roomIDs {
+		rooms[roomID] = struct{}{}
+	}
+	for _, roomID := range otherRoomIDs {
+		if _, ok := rooms[roomID]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
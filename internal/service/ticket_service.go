@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"chat-server/internal/domain/entity"
+	"chat-server/internal/domain/use_case"
+)
+
+type TicketConfig struct {
+	// TTL is how long an issued ticket can be redeemed, enough to open the WebSocket right away
+	TTL time.Duration
+	// AllowQueryAccessToken keeps accepting the access token in the query string of the chat WebSockets.
+	// It is a temporary switch for the clients not using tickets yet and is off by default.
+	AllowQueryAccessToken bool
+}
+
+type ticketService struct {
+	repo use_case.TicketStorage
+	ttl  time.Duration
+}
+
+func NewTicketService(c *TicketConfig, repo use_case.TicketStorage) use_case.TicketUseCase {
+	return &ticketService{
+		repo: repo,
+		ttl:  c.TTL,
+	}
+}
+
+func (t *ticketService) IssueTicket(
+	ctx context.Context,
+	userID entity.ID,
+	username entity.NonEmptyString,
+	roomID entity.ID,
+) (*entity.CreateTicketRes, error) {
+	value, err := newTicketValue()
+	if err != nil {
+		return nil, fmt.Errorf("ticketService.IssueTicket: %w", err)
+	}
+
+	ticket := &entity.Ticket{
+		Value:    value,
+		UserID:   userID,
+		Username: username,
+		RoomID:   roomID,
+	}
+	if err := t.repo.SaveTicket(ctx, ticket, t.ttl); err != nil {
+		return nil, fmt.Errorf("ticketService.IssueTicket: %w", err)
+	}
+	return &entity.CreateTicketRes{Ticket: value, ExpiresIn: int64(t.ttl.Seconds())}, nil
+}
+
+func (t *ticketService) RedeemTicket(ctx context.Context, value string) (*entity.Ticket, error) {
+	ticket, err := t.repo.TakeTicket(ctx, value)
+	if err != nil {
+		return nil, fmt.Errorf("ticketService.RedeemTicket: %w", err)
+	}
+	return ticket, nil
+}
+
+func newTicketValue() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("newTicketValue: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"chat-server/internal/domain/entity"
+)
+
+type typingKey struct {
+	roomID entity.ID
+	userID entity.ID
+}
+
+// typingConn is a connection of the user typing in the room, whose typing expires on its own.
+type typingConn struct {
+	timer *time.Timer
+}
+
+// typingState holds the connections of the user typing in the room.
+type typingState struct {
+	conns map[string]*typingConn
+}
+
+// TypingTracker keeps ephemeral typing states of users in rooms.
+// A user is typing while any of their connections is, and the typing of a connection
+// expires on its own if it is not refreshed within the timeout.
+type TypingTracker struct {
+	timeout  time.Duration
+	onExpire func(roomID entity.ID, userID entity.ID)
+
+	mu     sync.Mutex
+	states map[typingKey]*typingState
+}
+
+func NewTypingTracker(
+	timeout time.Duration,
+	onExpire func(roomID entity.ID, userID entity.ID),
+) *TypingTracker {
+	return &TypingTracker{
+		timeout:  timeout,
+		onExpire: onExpire,
+		states:   make(map[typingKey]*typingState),
+	}
+}
+
+// Start marks the connection of the user as typing in the room and returns true
+// if the user was not typing before through any connection.
+func (t *TypingTracker) Start(roomID entity.ID, userID entity.ID, connID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := typingKey{roomID: roomID, userID: userID}
+	state, typing := t.states[key]
+	if !typing {
+		state = &typingState{conns: make(map[string]*typingConn)}
+		t.states[key] = state
+	}
+	if current, ok := state.conns[connID]; ok && current.timer.Stop() {
+		current.timer.Reset(t.timeout)
+		return false
+	}
+
+	// either the connection is not typing or its timer has already fired and
+	// the pending expiration will be ignored because the connection is replaced
+	conn := &typingConn{}
+	conn.timer = time.AfterFunc(t.timeout, func() {
+		t.expire(key, connID, conn)
+	})
+	state.conns[connID] = conn
+	return !typing
+}
+
+// Stop clears the typing of the connection of the user in the room and returns true
+// if it was the last connection the user was typing through.
+func (t *TypingTracker) Stop(roomID entity.ID, userID entity.ID, connID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := typingKey{roomID: roomID, userID: userID}
+	state, ok := t.states[key]
+	if !ok {
+		return false
+	}
+	conn, ok := state.conns[connID]
+	if !ok {
+		return false
+	}
+	conn.timer.Stop()
+	delete(state.conns, connID)
+	if len(state.conns) > 0 {
+		return false
+	}
+	delete(t.states, key)
+	return true
+}
+
+// expire removes the connection only if it is still the one whose timer fired,
+// so a connection restarted concurrently is left intact. The user stops typing
+// with the last connection.
+func (t *TypingTracker) expire(key typingKey, connID string, conn *typingConn) {
+	t.mu.Lock()
+	state, ok := t.states[key]
+	if !ok || state.conns[connID] != conn {
+		t.mu.Unlock()
+		return
+	}
+	delete(state.conns, connID)
+	if len(state.conns) > 0 {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.states, key)
+	t.mu.Unlock()
+
+	t.onExpire(key.roomID, key.userID)
+}
@@ -12,25 +12,89 @@ const (
 const (
 	InsertMemberQuery             = ` INSERT INTO members (room_id, user_id) VALUES ($1, $2)`
 	SelectMemberBulkByRoomIDQuery = `SELECT room_id, user_id FROM members WHERE room_id = $1`
+	SelectMemberBulkByUserIDQuery = `SELECT room_id, user_id FROM members WHERE user_id = $1`
 	UpdateMemberQuery             = `UPDATE members SET room_id = $1, user_id = $2 WHERE room_id = $3 AND user_id = $4`
 	DeleteMemberQuery             = `DELETE FROM members WHERE room_id = $1 AND user_id = $2`
 )
 
 // Message queries
 const (
-	InsertMessageQuery                    = `INSERT INTO messages (sender_id, room_id, content) VALUES ($1, $2, $3) RETURNING id, created_at`
-	SelectMessageQuery                    = `SELECT id, sender_id, room_id, content, status, created_at, updated_at, deleted_at FROM messages WHERE id = $1 AND is_active = true`
-	UpdateMessageQuery                    = `UPDATE messages SET sender_id = $1, room_id = $2, content = $3, status = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $5`
-	SoftDeleteMessageByIDQuery            = `UPDATE messages SET is_active = false, deleted_at = CURRENT_TIMESTAMP WHERE id = $1`
-	SoftDeleteMessageBulkByRoomIDQuery    = `UPDATE messages SET is_active = false, deleted_at = CURRENT_TIMESTAMP WHERE room_id = $1`
-	SelectMessageBulkPaginateQuery        = `SELECT id, sender_id, room_id, content, status, created_at, updated_at, deleted_at FROM messages WHERE is_active = true AND room_id = $1 LIMIT $2 OFFSET $3`
-	SelectMessageBulkPaginateReverseQuery = `SELECT id, sender_id, room_id, content, status, created_at, updated_at, deleted_at FROM messages WHERE is_active = true AND room_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	InsertMessageQuery                = `INSERT INTO messages (sender_id, room_id, content, client_nonce, parent_id) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, 0)) ON CONFLICT (sender_id, client_nonce) DO NOTHING RETURNING id, created_at`
+	SelectMessageIDBulkQuery          = `SELECT nextval(pg_get_serial_sequence('messages', 'id')) FROM generate_series(1, $1)`
+	InsertMessageBulkQuery            = `INSERT INTO messages (id, sender_id, room_id, content, client_nonce, parent_id) SELECT id, sender_id, room_id, content, NULLIF(client_nonce, ''), NULLIF(parent_id, 0) FROM unnest($1::integer[], $2::integer[], $3::integer[], $4::text[], $5::text[], $6::integer[]) AS m(id, sender_id, room_id, content, client_nonce, parent_id) ON CONFLICT (sender_id, client_nonce) DO NOTHING RETURNING id, created_at`
+	SelectMessageQuery                = `SELECT id, sender_id, room_id, content, status, created_at, updated_at, deleted_at, COALESCE(client_nonce, ''), COALESCE(parent_id, 0), revision_count, revision_count > 0 FROM messages WHERE id = $1 AND is_active = true`
+	UpdateMessageQuery                = `UPDATE messages SET sender_id = $1, room_id = $2, content = $3, status = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $5`
+	MarkReadMessageBulkQuery          = `UPDATE messages SET status = 'read' WHERE room_id = $1 AND id > $2 AND id <= $3 AND sender_id <> $4 AND status <> 'read' AND is_active = true`
+	MarkDeliveredMessageBulkQuery     = `UPDATE messages SET status = 'delivered' WHERE room_id = $1 AND id > $2 AND id <= $3 AND sender_id <> $4 AND status = 'sent' AND is_active = true`
+	MarkDeliveredMessageBulkByIDQuery = `UPDATE messages SET status = 'delivered' WHERE room_id = $1 AND id = ANY($2) AND sender_id <> $3 AND status = 'sent' AND is_active = true`
+	SelectMessageBulkLatestQuery      = `SELECT id, sender_id, room_id, content, status, created_at, updated_at, deleted_at, COALESCE(client_nonce, ''), COALESCE(parent_id, 0), revision_count, revision_count > 0 FROM messages WHERE is_active = true AND room_id = $1 ORDER BY id DESC LIMIT $2`
+	SelectMessageBulkBeforeIDQuery    = `SELECT id, sender_id, room_id, content, status, created_at, updated_at, deleted_at, COALESCE(client_nonce, ''), COALESCE(parent_id, 0), revision_count, revision_count > 0 FROM messages WHERE is_active = true AND room_id = $1 AND id < $2 ORDER BY id DESC LIMIT $3`
+	SelectMessageByClientNonceQuery   = `SELECT id, sender_id, room_id, content, status, created_at, updated_at, deleted_at, COALESCE(client_nonce, ''), COALESCE(parent_id, 0), revision_count, revision_count > 0 FROM messages WHERE sender_id = $1 AND client_nonce = $2 AND is_active = true`
+	SelectMessageBulkAfterIDQuery     = `SELECT id, sender_id, room_id, content, status, created_at, updated_at, deleted_at, COALESCE(client_nonce, ''), COALESCE(parent_id, 0), revision_count, revision_count > 0 FROM messages WHERE is_active = true AND room_id = $1 AND id > $2 ORDER BY id LIMIT $3`
+	SelectThreadReplyBulkAfterIDQuery = `SELECT id, sender_id, room_id, content, status, created_at, updated_at, deleted_at, COALESCE(client_nonce, ''), COALESCE(parent_id, 0), revision_count, revision_count > 0 FROM messages WHERE is_active = true AND parent_id = $1 AND id > $2 ORDER BY id LIMIT $3`
+	SelectThreadSummaryBulkQuery      = `SELECT parent_id, COUNT(*), MAX(created_at) FROM messages WHERE is_active = true AND parent_id = ANY($1) GROUP BY parent_id`
+	SelectReceiptCountsQuery          = `SELECT m.id,
+		(SELECT COUNT(*) FROM delivery_cursors d WHERE d.room_id = m.room_id AND d.last_delivered_message_id >= m.id AND d.user_id <> m.sender_id),
+		(SELECT COUNT(*) FROM read_cursors r WHERE r.room_id = m.room_id AND r.last_read_message_id >= m.id AND r.user_id <> m.sender_id),
+		(SELECT COUNT(*) FROM members mb WHERE mb.room_id = m.room_id AND mb.user_id <> m.sender_id)
+		FROM messages m WHERE m.id = $1`
+	// the replaced content is kept as a revision by the same statement
+	UpdateMessageContentQuery = `WITH previous AS (SELECT id, content, revision_count, COALESCE(updated_at, created_at) AS written_at FROM messages WHERE id = $1 AND is_active = true FOR UPDATE),
+		revision AS (INSERT INTO message_revisions (message_id, revision, content, written_at) SELECT id, revision_count + 1, content, written_at FROM previous)
+		UPDATE messages m SET content = $2, revision_count = p.revision_count + 1, updated_at = CURRENT_TIMESTAMP FROM previous p WHERE m.id = p.id
+		RETURNING m.revision_count, m.updated_at`
+	// the pins of the deleted messages are removed by the same statement
+	SoftDeleteMessageByIDQuery = `WITH deleted AS (UPDATE messages SET is_active = false, deleted_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING id)
+		DELETE FROM pinned_messages WHERE message_id IN (SELECT id FROM deleted)`
+	SoftDeleteMessageBulkByRoomIDQuery = `WITH deleted AS (UPDATE messages SET is_active = false, deleted_at = CURRENT_TIMESTAMP WHERE room_id = $1 RETURNING id)
+		DELETE FROM pinned_messages WHERE message_id IN (SELECT id FROM deleted)`
+)
+
+// Read cursor queries
+const (
+	UpsertReadCursorQuery = `WITH previous AS (SELECT last_read_message_id FROM read_cursors WHERE room_id = $1 AND user_id = $2)
+		INSERT INTO read_cursors (room_id, user_id, last_read_message_id) VALUES ($1, $2, $3)
+		ON CONFLICT (room_id, user_id) DO UPDATE SET last_read_message_id = GREATEST(read_cursors.last_read_message_id, EXCLUDED.last_read_message_id), updated_at = CURRENT_TIMESTAMP
+		RETURNING last_read_message_id, updated_at, COALESCE((SELECT last_read_message_id FROM previous), 0)`
+	SelectReadCursorBulkByRoomIDQuery = `SELECT room_id, user_id, last_read_message_id, updated_at FROM read_cursors WHERE room_id = $1`
+)
+
+// Delivery cursor queries
+const (
+	UpsertDeliveryCursorQuery = `WITH previous AS (SELECT last_delivered_message_id FROM delivery_cursors WHERE room_id = $1 AND user_id = $2)
+		INSERT INTO delivery_cursors (room_id, user_id, last_delivered_message_id) VALUES ($1, $2, $3)
+		ON CONFLICT (room_id, user_id) DO UPDATE SET last_delivered_message_id = GREATEST(delivery_cursors.last_delivered_message_id, EXCLUDED.last_delivered_message_id), updated_at = CURRENT_TIMESTAMP
+		RETURNING last_delivered_message_id, updated_at, COALESCE((SELECT last_delivered_message_id FROM previous), 0)`
+	SelectDeliveryCursorBulkByRoomIDQuery = `SELECT room_id, user_id, last_delivered_message_id, updated_at FROM delivery_cursors WHERE room_id = $1`
+)
+
+// Reaction queries
+const (
+	InsertReactionQuery          = `INSERT INTO message_reactions (message_id, user_id, emoji) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	DeleteReactionQuery          = `DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3`
+	SelectReactionCountQuery     = `SELECT COUNT(*) FROM message_reactions WHERE message_id = $1 AND emoji = $2`
+	SelectReactionCountBulkQuery = `SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id = $2) FROM message_reactions WHERE message_id = ANY($1) GROUP BY message_id, emoji ORDER BY message_id, MIN(created_at), emoji`
+)
+
+// Revision queries
+const (
+	SelectRevisionBulkByMessageIDQuery = `SELECT message_id, revision, content, written_at, replaced_at FROM message_revisions WHERE message_id = $1 ORDER BY revision`
+)
+
+// Pin queries
+const (
+	InsertPinQuery = `INSERT INTO pinned_messages (room_id, message_id, pinned_by) VALUES ($1, $2, $3) ON CONFLICT (message_id) DO NOTHING RETURNING pinned_at`
+	DeletePinQuery = `DELETE FROM pinned_messages WHERE room_id = $1 AND message_id = $2`
+	// pins are listed in the order they were pinned
+	SelectPinBulkByRoomIDQuery = `SELECT p.room_id, p.message_id, p.pinned_by, p.pinned_at,
+		m.id, m.sender_id, m.room_id, m.content, m.status, m.created_at, m.updated_at, m.deleted_at, COALESCE(m.client_nonce, ''), COALESCE(m.parent_id, 0), m.revision_count, m.revision_count > 0
+		FROM pinned_messages p JOIN messages m ON m.id = p.message_id WHERE p.room_id = $1 AND m.is_active = true ORDER BY p.id`
 )
 
 // Room queries
 const (
-	InsertRoomQuery     = `INSERT INTO rooms (owner_id, name) VALUES ($1, $2) RETURNING id`
-	SelectRoomByIDQuery = `SELECT id, owner_id, name FROM rooms WHERE id = $1`
-	UpdateRoomQuery     = `UPDATE rooms SET name = $1 WHERE id = $2`
+	InsertRoomQuery     = `INSERT INTO rooms (owner_id, name) VALUES ($1, $2) RETURNING id, allow_ephemeral`
+	SelectRoomByIDQuery = `SELECT id, owner_id, name, allow_ephemeral FROM rooms WHERE id = $1`
+	UpdateRoomQuery     = `UPDATE rooms SET name = $1, allow_ephemeral = $2 WHERE id = $3`
 	DeleteRoomQuery     = `DELETE FROM rooms WHERE id = $1`
 )
@@ -0,0 +1 @@
+DROP TABLE read_cursors;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX messages_sender_id_client_nonce_key;
+ALTER TABLE messages DROP COLUMN client_nonce;
\ No newline at end of file
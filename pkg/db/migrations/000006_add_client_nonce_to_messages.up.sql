@@ -0,0 +1,2 @@
+ALTER TABLE messages ADD COLUMN client_nonce VARCHAR(64);
+CREATE UNIQUE INDEX messages_sender_id_client_nonce_key ON messages (sender_id, client_nonce);
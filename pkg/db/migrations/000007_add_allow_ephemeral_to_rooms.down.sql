@@ -0,0 +1 @@
+ALTER TABLE rooms DROP COLUMN allow_ephemeral;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE rooms ADD COLUMN allow_ephemeral BOOLEAN NOT NULL DEFAULT true;
@@ -0,0 +1,4 @@
+UPDATE messages SET status = 'sent' WHERE status = 'delivered';
+ALTER TABLE messages DROP CONSTRAINT messages_status_check;
+ALTER TABLE messages ADD CONSTRAINT messages_status_check CHECK (status IN ('sent', 'read'));
+DROP TABLE delivery_cursors;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE delivery_cursors (
+    room_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    last_delivered_message_id INTEGER NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, user_id),
+    FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (last_delivered_message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+ALTER TABLE messages DROP CONSTRAINT messages_status_check;
+ALTER TABLE messages ADD CONSTRAINT messages_status_check CHECK (status IN ('sent', 'delivered', 'read'));
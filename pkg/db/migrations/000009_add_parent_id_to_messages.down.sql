@@ -0,0 +1,2 @@
+DROP INDEX messages_parent_id_idx;
+ALTER TABLE messages DROP COLUMN parent_id;
\ No newline at end of file
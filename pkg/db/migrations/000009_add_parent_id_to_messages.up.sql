@@ -0,0 +1,2 @@
+ALTER TABLE messages ADD COLUMN parent_id INTEGER REFERENCES messages(id) ON DELETE CASCADE;
+CREATE INDEX messages_parent_id_idx ON messages (parent_id, id);
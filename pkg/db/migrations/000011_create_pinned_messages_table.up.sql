@@ -0,0 +1,11 @@
+CREATE TABLE pinned_messages (
+    id SERIAL PRIMARY KEY,
+    room_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL UNIQUE,
+    pinned_by INTEGER NOT NULL,
+    pinned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (pinned_by) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX pinned_messages_room_id_idx ON pinned_messages (room_id, id);
@@ -0,0 +1,2 @@
+DROP TABLE message_revisions;
+ALTER TABLE messages DROP COLUMN revision_count;
\ No newline at end of file
@@ -0,0 +1,10 @@
+ALTER TABLE messages ADD COLUMN revision_count INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE message_revisions (
+    message_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    written_at TIMESTAMP,
+    replaced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, revision),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
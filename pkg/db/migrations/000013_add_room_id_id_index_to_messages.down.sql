@@ -0,0 +1 @@
+DROP INDEX messages_room_id_id_idx;
\ No newline at end of file